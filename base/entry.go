@@ -1,10 +1,21 @@
 // Package base for common code
 package base
 
-import "golang.org/x/exp/constraints"
+import (
+	"golang.org/x/exp/constraints"
+	"time"
+)
 
 // Entry represents a key-value pair
 type Entry[K constraints.Ordered, V any] struct {
 	Key   K
 	Value V
 }
+
+// Metadata describes the last modification of an entry
+type Metadata struct {
+	Sequence  uint64    // position of the last write in the global order of all writes
+	Timestamp time.Time // time of the last write
+	Version   uint64    // number of writes since the key has been created
+	ExpiresAt time.Time // end of the time-to-live, zero if the entry does not expire
+}
@@ -0,0 +1,46 @@
+package base
+
+import (
+	"golang.org/x/exp/constraints"
+	"iter"
+)
+
+// Merge combines iterators which are ordered by key into one ordered iterator, in ascending order or in descending
+// order if reverse is set. Each key is returned once, with the value of the first iterator containing it.
+func Merge[K constraints.Ordered, V any](reverse bool, seqs ...iter.Seq2[K, V]) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		type source struct {
+			next  func() (K, V, bool)
+			key   K
+			value V
+			valid bool
+		}
+		sources := make([]*source, len(seqs))
+		for i, seq := range seqs {
+			next, stop := iter.Pull2(seq)
+			defer stop()
+			sources[i] = &source{next: next}
+			sources[i].key, sources[i].value, sources[i].valid = next()
+		}
+		for {
+			var current *source
+			for _, s := range sources {
+				if s.valid && (current == nil || (!reverse && s.key < current.key) || (reverse && s.key > current.key)) {
+					current = s
+				}
+			}
+			if current == nil {
+				return
+			}
+			key, value := current.key, current.value
+			for _, s := range sources {
+				if s.valid && s.key == key {
+					s.key, s.value, s.valid = s.next()
+				}
+			}
+			if !yield(key, value) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,10 @@
+package base
+
+// RangeOptions controls bounds, order and size of a range scan. The zero value
+// selects all keys between both bounds (inclusive) in ascending order.
+type RangeOptions struct {
+	ExcludeFrom bool // skip entries equal to the lower bound
+	ExcludeTo   bool // skip entries equal to the upper bound
+	Reverse     bool // return entries in descending key order
+	Limit       int  // maximum number of entries, 0 means unlimited
+}
@@ -0,0 +1,91 @@
+// Contains a bloom filter, a compact set of keys which answers membership queries with false positives but
+// without false negatives. The bit positions of a key are derived from its 64-bit FNV-1a hash by double hashing.
+package bloom
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+)
+
+// ErrInvalidFilter is returned by UnmarshalBinary for data which is not a marshalled filter
+var ErrInvalidFilter = errors.New("invalid bloom filter")
+
+const (
+	minFalsePositiveRate = 1e-9
+	maxFalsePositiveRate = 0.5
+	maxHashes            = 30
+)
+
+// Filter is a bloom filter. A filter is not safe for concurrent use while keys are added.
+type Filter struct {
+	bits   []byte
+	hashes uint8 // number of bits set per key
+}
+
+// New creates a filter for n keys with the given false positive rate. Rates are limited to the range from 1e-9 to
+// 0.5.
+func New(n int, falsePositiveRate float64) *Filter {
+	n = max(n, 1)
+	rate := min(max(falsePositiveRate, minFalsePositiveRate), maxFalsePositiveRate)
+	bits := math.Ceil(-float64(n) * math.Log(rate) / (math.Ln2 * math.Ln2))
+	size := max(int(math.Ceil(bits/8)), 8)
+	hashes := math.Round(float64(size*8) / float64(n) * math.Ln2)
+	return &Filter{bits: make([]byte, size), hashes: uint8(min(max(hashes, 1), maxHashes))}
+}
+
+// Hash returns the hash of key used by AddHash and MayContainHash
+func Hash(key []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(key)
+	return h.Sum64()
+}
+
+// Add adds key to the filter
+func (f *Filter) Add(key []byte) {
+	f.AddHash(Hash(key))
+}
+
+// AddHash adds a key by its Hash
+func (f *Filter) AddHash(hash uint64) {
+	for i := range f.hashes {
+		bit := f.position(hash, i)
+		f.bits[bit/8] |= 1 << (bit % 8)
+	}
+}
+
+// MayContain reports whether key may have been added. False means key has not been added.
+func (f *Filter) MayContain(key []byte) bool {
+	return f.MayContainHash(Hash(key))
+}
+
+// MayContainHash reports whether a key with the given Hash may have been added
+func (f *Filter) MayContainHash(hash uint64) bool {
+	for i := range f.hashes {
+		if bit := f.position(hash, i); f.bits[bit/8]&(1<<(bit%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// position returns the i-th bit of a key: h1 + i*h2, where h1 and h2 are the lower and upper half of the hash
+func (f *Filter) position(hash uint64, i uint8) uint64 {
+	h1, h2 := hash&math.MaxUint32, hash>>32
+	return (h1 + uint64(i)*h2) % (uint64(len(f.bits)) * 8)
+}
+
+// MarshalBinary encodes the filter as the number of hashes followed by the bits
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	return append([]byte{f.hashes}, f.bits...), nil
+}
+
+// UnmarshalBinary decodes a filter encoded by MarshalBinary
+func (f *Filter) UnmarshalBinary(data []byte) error {
+	if len(data) < 2 || data[0] == 0 || data[0] > maxHashes {
+		return fmt.Errorf("%w: %d bytes", ErrInvalidFilter, len(data))
+	}
+	f.hashes, f.bits = data[0], append([]byte{}, data[1:]...)
+	return nil
+}
@@ -0,0 +1,46 @@
+package bloom
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mwildt/goodb/utils/testutils"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	filter := New(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		filter.Add([]byte(fmt.Sprintf("key-%d", i)))
+	}
+	for i := 0; i < 10000; i++ {
+		testutils.Assert(t, filter.MayContain([]byte(fmt.Sprintf("key-%d", i))), "key-%d has not been found", i)
+	}
+	falsePositives := 0
+	for i := 10000; i < 20000; i++ {
+		if filter.MayContain([]byte(fmt.Sprintf("key-%d", i))) {
+			falsePositives++
+		}
+	}
+	testutils.Assert(t, falsePositives < 200, "expected about 100 false positives, but got %d", falsePositives)
+}
+
+func TestFilter_FalsePositiveRate(t *testing.T) {
+	small, large := New(1000, 0.1), New(1000, 0.001)
+	testutils.Assert(t, len(large.bits) > len(small.bits) && large.hashes > small.hashes, "lower rate has not increased the filter")
+	empty := New(0, 2)
+	testutils.Assert(t, !empty.MayContain([]byte("key")), "empty filter contains a key")
+}
+
+func TestFilter_Marshal(t *testing.T) {
+	filter := New(100, 0.01)
+	filter.Add([]byte("eins"))
+	data, _ := filter.MarshalBinary()
+
+	decoded := &Filter{}
+	testutils.AssertNoError(t, decoded.UnmarshalBinary(data), "fehler beim dekodieren")
+	testutils.Assert(t, decoded.MayContain([]byte("eins")), "key has not been found")
+	testutils.Assert(t, decoded.hashes == filter.hashes && len(decoded.bits) == len(filter.bits), "unexpected filter")
+
+	err := decoded.UnmarshalBinary([]byte{0})
+	testutils.Assert(t, errors.Is(err, ErrInvalidFilter), "expected ErrInvalidFilter, but got %v", err)
+}
@@ -0,0 +1,191 @@
+package codecs
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"golang.org/x/exp/constraints"
+	"math"
+	"reflect"
+)
+
+// ErrInvalidBinary is returned when decoding truncated or malformed binary data
+var ErrInvalidBinary = errors.New("invalid binary encoding")
+
+type binaryFormat struct{}
+
+// BinaryFormat encodes values implementing encoding.BinaryMarshaler and decodes into values implementing
+// encoding.BinaryUnmarshaler
+func BinaryFormat() Format {
+	return binaryFormat{}
+}
+
+func (binaryFormat) Name() string {
+	return "binary"
+}
+
+func (binaryFormat) Marshal(value any) ([]byte, error) {
+	if marshaler, ok := value.(encoding.BinaryMarshaler); ok {
+		return marshaler.MarshalBinary()
+	}
+	return nil, fmt.Errorf("%T does not implement encoding.BinaryMarshaler", value)
+}
+
+func (binaryFormat) Unmarshal(data []byte, value any) error {
+	if unmarshaler, ok := value.(encoding.BinaryUnmarshaler); ok {
+		return unmarshaler.UnmarshalBinary(data)
+	}
+	return fmt.Errorf("%T does not implement encoding.BinaryUnmarshaler", value)
+}
+
+// AppendOrdered appends the binary encoding of key to data. Signed integers are encoded as zigzag varints, unsigned
+// integers as varints, floats as their fixed size IEEE 754 bits and strings length prefixed.
+func AppendOrdered[K constraints.Ordered](data []byte, key K) []byte {
+	value := reflect.ValueOf(key)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.AppendVarint(data, value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return binary.AppendUvarint(data, value.Uint())
+	case reflect.Float32:
+		return binary.LittleEndian.AppendUint32(data, math.Float32bits(float32(value.Float())))
+	case reflect.Float64:
+		return binary.LittleEndian.AppendUint64(data, math.Float64bits(value.Float()))
+	default:
+		return AppendString(data, value.String())
+	}
+}
+
+// AppendBytes appends value with a varint length prefix to data
+func AppendBytes(data []byte, value []byte) []byte {
+	data = binary.AppendUvarint(data, uint64(len(value)))
+	return append(data, value...)
+}
+
+// AppendString appends value with a varint length prefix to data
+func AppendString(data []byte, value string) []byte {
+	data = binary.AppendUvarint(data, uint64(len(value)))
+	return append(data, value...)
+}
+
+// BinaryDecoder reads values written with AppendOrdered, AppendBytes and the Append functions of encoding/binary.
+// The first error is kept and returned by Err, all reads after an error return zero values.
+type BinaryDecoder struct {
+	data []byte
+	err  error
+}
+
+func NewBinaryDecoder(data []byte) *BinaryDecoder {
+	return &BinaryDecoder{data: data}
+}
+
+// Err returns the first error which occurred while reading
+func (d *BinaryDecoder) Err() error {
+	return d.err
+}
+
+// Remaining returns the number of bytes which have not been read yet
+func (d *BinaryDecoder) Remaining() int {
+	return len(d.data)
+}
+
+func (d *BinaryDecoder) fail() {
+	if d.err == nil {
+		d.err = ErrInvalidBinary
+	}
+	d.data = nil
+}
+
+// Byte reads a single byte
+func (d *BinaryDecoder) Byte() byte {
+	if len(d.data) < 1 {
+		d.fail()
+		return 0
+	}
+	value := d.data[0]
+	d.data = d.data[1:]
+	return value
+}
+
+// Uvarint reads a value written with binary.AppendUvarint
+func (d *BinaryDecoder) Uvarint() uint64 {
+	value, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.data = d.data[n:]
+	return value
+}
+
+// Varint reads a value written with binary.AppendVarint
+func (d *BinaryDecoder) Varint() int64 {
+	value, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.data = d.data[n:]
+	return value
+}
+
+// Fixed reads size bytes
+func (d *BinaryDecoder) Fixed(size int) []byte {
+	if size < 0 || len(d.data) < size {
+		d.fail()
+		return nil
+	}
+	value := d.data[:size:size]
+	d.data = d.data[size:]
+	return value
+}
+
+// Bytes reads a value written with AppendBytes. The result refers to the decoded data.
+func (d *BinaryDecoder) Bytes() []byte {
+	size := d.Uvarint()
+	if size > uint64(len(d.data)) {
+		d.fail()
+		return nil
+	}
+	return d.Fixed(int(size))
+}
+
+// String reads a value written with AppendString
+func (d *BinaryDecoder) String() string {
+	return string(d.Bytes())
+}
+
+// DecodeOrdered reads a key written with AppendOrdered
+func DecodeOrdered[K constraints.Ordered](d *BinaryDecoder) (key K) {
+	value := reflect.ValueOf(&key).Elem()
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if decoded := d.Varint(); value.OverflowInt(decoded) {
+			d.fail()
+		} else {
+			value.SetInt(decoded)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if decoded := d.Uvarint(); value.OverflowUint(decoded) {
+			d.fail()
+		} else {
+			value.SetUint(decoded)
+		}
+	case reflect.Float32:
+		if fixed := d.Fixed(4); fixed != nil {
+			value.SetFloat(float64(math.Float32frombits(binary.LittleEndian.Uint32(fixed))))
+		}
+	case reflect.Float64:
+		if fixed := d.Fixed(8); fixed != nil {
+			value.SetFloat(math.Float64frombits(binary.LittleEndian.Uint64(fixed)))
+		}
+	default:
+		value.SetString(d.String())
+	}
+	if d.err != nil {
+		var zero K
+		return zero
+	}
+	return key
+}
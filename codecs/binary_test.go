@@ -0,0 +1,53 @@
+package codecs
+
+import (
+	"errors"
+	"github.com/mwildt/goodb/utils/testutils"
+	"testing"
+)
+
+type userID int16
+
+func assertOrderedRoundTrip[K comparable](t *testing.T, encode func([]byte) []byte, decode func(*BinaryDecoder) K, expected K) {
+	decoder := NewBinaryDecoder(encode(nil))
+	decoded := decode(decoder)
+	testutils.AssertNoError(t, decoder.Err(), "FEHLER")
+	testutils.Assert(t, decoded == expected, "expected %v, but got %v", expected, decoded)
+	testutils.Assert(t, decoder.Remaining() == 0, "%d bytes remaining after %v", decoder.Remaining(), expected)
+}
+
+func TestOrderedRoundTrip(t *testing.T) {
+	for _, value := range []int{0, 1, -1, 1 << 40, -1 << 40} {
+		assertOrderedRoundTrip(t, func(data []byte) []byte { return AppendOrdered(data, value) }, DecodeOrdered[int], value)
+	}
+	for _, value := range []uint8{0, 255} {
+		assertOrderedRoundTrip(t, func(data []byte) []byte { return AppendOrdered(data, value) }, DecodeOrdered[uint8], value)
+	}
+	for _, value := range []float32{0, -1.5, 3.25} {
+		assertOrderedRoundTrip(t, func(data []byte) []byte { return AppendOrdered(data, value) }, DecodeOrdered[float32], value)
+	}
+	for _, value := range []float64{0, -1.5, 1e300} {
+		assertOrderedRoundTrip(t, func(data []byte) []byte { return AppendOrdered(data, value) }, DecodeOrdered[float64], value)
+	}
+	for _, value := range []string{"", "schlüssel"} {
+		assertOrderedRoundTrip(t, func(data []byte) []byte { return AppendOrdered(data, value) }, DecodeOrdered[string], value)
+	}
+	assertOrderedRoundTrip(t, func(data []byte) []byte { return AppendOrdered(data, userID(-42)) }, DecodeOrdered[userID], userID(-42))
+	testutils.Assert(t, len(AppendOrdered(nil, 1)) == 1, "small integers are expected to be encoded as single byte")
+}
+
+func TestBinaryDecoder_Invalid(t *testing.T) {
+	decoder := NewBinaryDecoder(AppendString(nil, "schlüssel")[:4])
+	value := DecodeOrdered[string](decoder)
+	testutils.Assert(t, errors.Is(decoder.Err(), ErrInvalidBinary), "expected ErrInvalidBinary, but got %v", decoder.Err())
+	testutils.Assert(t, value == "", "expected zero value, but got %s", value)
+
+	decoder = NewBinaryDecoder(AppendOrdered(nil, 300))
+	DecodeOrdered[int8](decoder)
+	testutils.Assert(t, errors.Is(decoder.Err(), ErrInvalidBinary), "expected ErrInvalidBinary for overflow, but got %v", decoder.Err())
+}
+
+func TestBinaryFormat(t *testing.T) {
+	_, err := BinaryFormat().Marshal("TEST")
+	testutils.Assert(t, err != nil, "value without MarshalBinary has been encoded")
+}
@@ -4,6 +4,7 @@ package codecs
 import (
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 )
 
 type Codec[T any] interface {
@@ -11,6 +12,19 @@ type Codec[T any] interface {
 	Decode([]byte) (T, error)
 }
 
+// Named is implemented by codecs and formats which have a stable name, it is recorded in the files they write
+type Named interface {
+	Name() string
+}
+
+// NameOf returns the name of a Named codec, or its type for other codecs
+func NameOf(codec any) string {
+	if named, ok := codec.(Named); ok {
+		return named.Name()
+	}
+	return fmt.Sprintf("%T", codec)
+}
+
 func NewBase64JsonCodec[T any]() Codec[T] {
 	return NewBase64WrapperCodec[T](NewJsonCodec[T]())
 }
@@ -20,6 +34,11 @@ type JsonCodec[T any] struct{}
 func NewJsonCodec[T any]() *JsonCodec[T] {
 	return &JsonCodec[T]{}
 }
+
+func (codec JsonCodec[T]) Name() string {
+	return "json"
+}
+
 func (codec JsonCodec[T]) Encode(value T) (bytes []byte, err error) {
 	return json.Marshal(value)
 }
@@ -41,6 +60,10 @@ func NewBase64WrapperCodec[T any](delegate Codec[T]) *Base64WrapperCodec[T] {
 	}
 }
 
+func (codec Base64WrapperCodec[T]) Name() string {
+	return "base64+" + NameOf(codec.delegate)
+}
+
 func (codec Base64WrapperCodec[T]) Encode(value T) (bytes []byte, err error) {
 	if encoded, err := codec.delegate.Encode(value); err != nil {
 		return bytes, err
@@ -2,6 +2,7 @@ package codecs
 
 import (
 	"github.com/mwildt/goodb/utils/testutils"
+	"reflect"
 	"testing"
 )
 
@@ -17,3 +18,83 @@ func TestBase64JsonCodec(t *testing.T) {
 	testutils.Assert(t, decoded == "TEST", "expected decoded value test, bu got %s", decoded)
 
 }
+
+func TestFormatCodec(t *testing.T) {
+	codec := NewFormatCodec[string](Base64Format(JsonFormat()))
+	enc, err := codec.Encode("TEST")
+	testutils.AssertNoError(t, err, "FEHLER")
+	testutils.Assert(t, string(enc) == "IlRFU1Qi", "expected base 64 ecodev value, bu got %s", string(enc))
+
+	decoded, err := codec.Decode(enc)
+	testutils.AssertNoError(t, err, "FEHLER")
+	testutils.Assert(t, decoded == "TEST", "expected decoded value test, bu got %s", decoded)
+
+	testutils.Assert(t, NameOf(codec) == NameOf(NewBase64JsonCodec[string]()), "expected equal names, but got %s", NameOf(codec))
+}
+
+type benchmarkValue struct {
+	ID          int
+	Name        string
+	Description string
+	Tags        []string
+	Attributes  map[string]string
+	Scores      []float64
+	Active      bool
+}
+
+func newBenchmarkValue() benchmarkValue {
+	value := benchmarkValue{
+		ID:          4711,
+		Name:        "Ein ziemlich großer Wert",
+		Description: "Werte mit vielen Feldern, deren Kodierung bei Set und Kompaktierung ins Gewicht fällt",
+		Tags:        []string{"eins", "zwei", "drei", "vier", "fünf"},
+		Attributes:  make(map[string]string),
+		Active:      true,
+	}
+	for i := 0; i < 20; i++ {
+		value.Attributes[string(rune('a'+i))] = value.Name
+		value.Scores = append(value.Scores, float64(i)/3)
+	}
+	return value
+}
+
+func TestGobCodec(t *testing.T) {
+	codec := NewGobCodec[benchmarkValue]()
+	value := newBenchmarkValue()
+	enc, err := codec.Encode(value)
+	testutils.AssertNoError(t, err, "FEHLER")
+
+	decoded, err := codec.Decode(enc)
+	testutils.AssertNoError(t, err, "FEHLER")
+	testutils.Assert(t, reflect.DeepEqual(decoded, value), "expected %v, but got %v", value, decoded)
+}
+
+func benchmarkCodec(b *testing.B, codec Codec[benchmarkValue]) {
+	value := newBenchmarkValue()
+	encoded, _ := codec.Encode(value)
+	b.Run("Encode", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			codec.Encode(value)
+		}
+	})
+	b.Run("Decode", func(b *testing.B) {
+		b.ReportAllocs()
+		b.ReportMetric(float64(len(encoded)), "bytes")
+		for i := 0; i < b.N; i++ {
+			codec.Decode(encoded)
+		}
+	})
+}
+
+func BenchmarkJsonCodec(b *testing.B) {
+	benchmarkCodec(b, NewJsonCodec[benchmarkValue]())
+}
+
+func BenchmarkGobCodec(b *testing.B) {
+	benchmarkCodec(b, NewGobCodec[benchmarkValue]())
+}
+
+func BenchmarkMsgpackCodec(b *testing.B) {
+	benchmarkCodec(b, NewMsgpackCodec[benchmarkValue]())
+}
@@ -0,0 +1,185 @@
+package codecs
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// Compressor is a compression algorithm used by CompressionWrapperCodec
+type Compressor interface {
+	Named
+	Compress(data []byte) ([]byte, error)
+	Decompress(data []byte) ([]byte, error)
+}
+
+type gzipCompressor struct {
+	level int
+}
+
+// GzipCompressor compresses with compress/gzip at the given level, e.g. gzip.DefaultCompression
+func GzipCompressor(level int) Compressor {
+	return gzipCompressor{level}
+}
+
+func (c gzipCompressor) Name() string {
+	return "gzip"
+}
+
+func (c gzipCompressor) Compress(data []byte) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	if writer, err := gzip.NewWriterLevel(&buffer, c.level); err != nil {
+		return nil, err
+	} else if _, err := writer.Write(data); err != nil {
+		return nil, err
+	} else if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (c gzipCompressor) Decompress(data []byte) ([]byte, error) {
+	reader, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+type flateCompressor struct {
+	level int
+}
+
+// FlateCompressor compresses with compress/flate at the given level, e.g. flate.DefaultCompression. It omits the
+// header and checksum of gzip.
+func FlateCompressor(level int) Compressor {
+	return flateCompressor{level}
+}
+
+func (c flateCompressor) Name() string {
+	return "flate"
+}
+
+func (c flateCompressor) Compress(data []byte) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	if writer, err := flate.NewWriter(&buffer, c.level); err != nil {
+		return nil, err
+	} else if _, err := writer.Write(data); err != nil {
+		return nil, err
+	} else if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func (c flateCompressor) Decompress(data []byte) ([]byte, error) {
+	reader := flate.NewReader(bytes.NewReader(data))
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// flag byte preceding the data written by CompressionWrapperCodec
+const (
+	uncompressed byte = 0
+	compressed   byte = 1
+)
+
+// CompressionWrapperCodec compresses the output of its delegate. Data smaller than the minimum size, or which does
+// not get smaller by compression, is stored uncompressed. A leading flag byte distinguishes both cases.
+type CompressionWrapperCodec[T any] struct {
+	delegate   Codec[T]
+	compressor Compressor
+	minSize    int
+}
+
+func NewCompressionWrapperCodec[T any](delegate Codec[T], compressor Compressor, minSize int) *CompressionWrapperCodec[T] {
+	return &CompressionWrapperCodec[T]{
+		delegate:   delegate,
+		compressor: compressor,
+		minSize:    minSize,
+	}
+}
+
+func (codec CompressionWrapperCodec[T]) Name() string {
+	return codec.compressor.Name() + "+" + NameOf(codec.delegate)
+}
+
+func (codec CompressionWrapperCodec[T]) Encode(value T) ([]byte, error) {
+	if encoded, err := codec.delegate.Encode(value); err != nil {
+		return nil, err
+	} else {
+		return compress(codec.compressor, codec.minSize, encoded)
+	}
+}
+
+func (codec CompressionWrapperCodec[T]) Decode(data []byte) (value T, err error) {
+	if decompressed, err := decompress(codec.compressor, data); err != nil {
+		return value, err
+	} else {
+		return codec.delegate.Decode(decompressed)
+	}
+}
+
+type compressionFormat struct {
+	delegate   Format
+	compressor Compressor
+	minSize    int
+}
+
+// CompressionFormat compresses the output of delegate, like CompressionWrapperCodec
+func CompressionFormat(delegate Format, compressor Compressor, minSize int) Format {
+	return compressionFormat{delegate: delegate, compressor: compressor, minSize: minSize}
+}
+
+func (format compressionFormat) Name() string {
+	return format.compressor.Name() + "+" + format.delegate.Name()
+}
+
+func (format compressionFormat) Marshal(value any) ([]byte, error) {
+	if encoded, err := format.delegate.Marshal(value); err != nil {
+		return nil, err
+	} else {
+		return compress(format.compressor, format.minSize, encoded)
+	}
+}
+
+func (format compressionFormat) Unmarshal(data []byte, value any) error {
+	if decompressed, err := decompress(format.compressor, data); err != nil {
+		return err
+	} else {
+		return format.delegate.Unmarshal(decompressed, value)
+	}
+}
+
+// compress prepends the flag byte to encoded data and compresses it, if it is at least minSize bytes long and
+// compression makes it smaller
+func compress(compressor Compressor, minSize int, encoded []byte) ([]byte, error) {
+	if len(encoded) < minSize {
+		return append([]byte{uncompressed}, encoded...), nil
+	}
+	data, err := compressor.Compress(encoded)
+	if err != nil {
+		return nil, err
+	} else if len(data) >= len(encoded) {
+		return append([]byte{uncompressed}, encoded...), nil
+	}
+	return append([]byte{compressed}, data...), nil
+}
+
+// decompress returns the data written by compress
+func decompress(compressor Compressor, data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return nil, ErrInvalidBinary
+	}
+	switch data[0] {
+	case uncompressed:
+		return data[1:], nil
+	case compressed:
+		return compressor.Decompress(data[1:])
+	default:
+		return nil, fmt.Errorf("%w: unknown compression flag %d", ErrInvalidBinary, data[0])
+	}
+}
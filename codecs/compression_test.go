@@ -0,0 +1,69 @@
+package codecs
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"github.com/mwildt/goodb/utils/testutils"
+	"strings"
+	"testing"
+)
+
+func TestCompressionWrapperCodec(t *testing.T) {
+	for _, compressor := range []Compressor{GzipCompressor(gzip.DefaultCompression), FlateCompressor(flate.BestSpeed)} {
+		codec := NewCompressionWrapperCodec[string](NewJsonCodec[string](), compressor, 64)
+		value := strings.Repeat("TEST", 100)
+		enc, err := codec.Encode(value)
+		testutils.AssertNoError(t, err, "FEHLER")
+		testutils.Assert(t, enc[0] == compressed && len(enc) < len(value), "%s: value has not been compressed", compressor.Name())
+
+		decoded, err := codec.Decode(enc)
+		testutils.AssertNoError(t, err, "FEHLER")
+		testutils.Assert(t, decoded == value, "%s: expected decoded value, but got %s", compressor.Name(), decoded)
+		testutils.Assert(t, codec.Name() == compressor.Name()+"+json", "unexpected name %s", codec.Name())
+	}
+}
+
+func TestCompressionWrapperCodec_Uncompressed(t *testing.T) {
+	codec := NewCompressionWrapperCodec[string](NewJsonCodec[string](), GzipCompressor(gzip.DefaultCompression), 64)
+	enc, err := codec.Encode("TEST")
+	testutils.AssertNoError(t, err, "FEHLER")
+	testutils.Assert(t, bytes.Equal(enc, []byte("\x00\"TEST\"")), "expected uncompressed value below minimum size, but got %q", enc)
+
+	// incompressible data is stored uncompressed as well
+	random := NewCompressionWrapperCodec[[]byte](NewJsonCodec[[]byte](), GzipCompressor(gzip.DefaultCompression), 0)
+	enc, err = random.Encode([]byte("z8Q"))
+	testutils.AssertNoError(t, err, "FEHLER")
+	testutils.Assert(t, enc[0] == uncompressed, "expected uncompressed value, but got %q", enc)
+	decoded, err := random.Decode(enc)
+	testutils.Assert(t, err == nil && string(decoded) == "z8Q", "unexpected decoded value %q (%v)", decoded, err)
+
+	_, err = codec.Decode([]byte{7, 1, 2})
+	testutils.Assert(t, errors.Is(err, ErrInvalidBinary), "expected ErrInvalidBinary, but got %v", err)
+}
+
+// unquoteCompressor "compresses" json strings by stripping their quotes
+type unquoteCompressor struct{}
+
+func (unquoteCompressor) Name() string {
+	return "unquote"
+}
+
+func (unquoteCompressor) Compress(data []byte) ([]byte, error) {
+	return data[1 : len(data)-1], nil
+}
+
+func (unquoteCompressor) Decompress(data []byte) ([]byte, error) {
+	return []byte("\"" + string(data) + "\""), nil
+}
+
+func TestCompressionWrapperCodec_PluggableCompressor(t *testing.T) {
+	codec := NewCompressionWrapperCodec[string](NewJsonCodec[string](), unquoteCompressor{}, 0)
+	enc, err := codec.Encode("TEST")
+	testutils.AssertNoError(t, err, "FEHLER")
+	testutils.Assert(t, bytes.Equal(enc, []byte("\x01TEST")), "custom compressor has not been used, got %q", enc)
+	testutils.Assert(t, codec.Name() == "unquote+json", "unexpected name %s", codec.Name())
+	decoded, err := codec.Decode(enc)
+	testutils.Assert(t, err == nil && decoded == "TEST", "unexpected decoded value %s (%v)", decoded, err)
+}
@@ -0,0 +1,146 @@
+package codecs
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var ErrUnknownKey = errors.New("unknown encryption key")
+var ErrDecryption = errors.New("decryption failed")
+
+// KeyRing holds the AES keys used by EncryptionWrapperCodec and EncryptionFormat by their IDs. Data is encrypted
+// with the current key and records the ID of its key, so keys can be rotated by adding a new current key while
+// keeping the old ones for reading.
+type KeyRing struct {
+	current string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyRing creates a KeyRing of AES-128, AES-192 or AES-256 keys. IDs must be between 1 and 255 bytes long.
+func NewKeyRing(current string, keys map[string][]byte) (*KeyRing, error) {
+	ring := &KeyRing{current: current, keys: make(map[string]cipher.AEAD, len(keys))}
+	for id, key := range keys {
+		if len(id) == 0 || len(id) > 255 {
+			return nil, fmt.Errorf("invalid key id %q", id)
+		}
+		if block, err := aes.NewCipher(key); err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		} else if aead, err := cipher.NewGCM(block); err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		} else {
+			ring.keys[id] = aead
+		}
+	}
+	if _, ok := ring.keys[current]; !ok {
+		return nil, fmt.Errorf("%w: current key %s", ErrUnknownKey, current)
+	}
+	return ring, nil
+}
+
+// Current returns the ID of the key used for encryption
+func (ring *KeyRing) Current() string {
+	return ring.current
+}
+
+// seal encrypts data with the current key. The result consists of the length prefixed key ID, the random nonce
+// and the ciphertext. The key ID is authenticated as additional data.
+func (ring *KeyRing) seal(data []byte) ([]byte, error) {
+	aead := ring.keys[ring.current]
+	header := append([]byte{byte(len(ring.current))}, ring.current...)
+	sealed := make([]byte, len(header)+aead.NonceSize(), len(header)+aead.NonceSize()+len(data)+aead.Overhead())
+	copy(sealed, header)
+	nonce := sealed[len(header):]
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(sealed, nonce, data, header), nil
+}
+
+// open decrypts data encrypted by seal with the key recorded in data
+func (ring *KeyRing) open(data []byte) ([]byte, error) {
+	if len(data) == 0 || len(data) < 1+int(data[0]) {
+		return nil, fmt.Errorf("%w: missing key id", ErrDecryption)
+	}
+	header := data[:1+int(data[0])]
+	aead, ok := ring.keys[string(header[1:])]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, header[1:])
+	}
+	data = data[len(header):]
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: missing nonce", ErrDecryption)
+	}
+	if plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], header); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecryption, err)
+	} else {
+		return plain, nil
+	}
+}
+
+// EncryptionWrapperCodec encrypts the output of its delegate with AES-GCM and a random nonce per value
+type EncryptionWrapperCodec[T any] struct {
+	delegate Codec[T]
+	keys     *KeyRing
+}
+
+func NewEncryptionWrapperCodec[T any](delegate Codec[T], keys *KeyRing) *EncryptionWrapperCodec[T] {
+	return &EncryptionWrapperCodec[T]{
+		delegate: delegate,
+		keys:     keys,
+	}
+}
+
+// Name does not contain the key ID, so rotating keys does not change the name of the codec
+func (codec EncryptionWrapperCodec[T]) Name() string {
+	return "aes-gcm+" + NameOf(codec.delegate)
+}
+
+func (codec EncryptionWrapperCodec[T]) Encode(value T) ([]byte, error) {
+	if encoded, err := codec.delegate.Encode(value); err != nil {
+		return nil, err
+	} else {
+		return codec.keys.seal(encoded)
+	}
+}
+
+func (codec EncryptionWrapperCodec[T]) Decode(data []byte) (value T, err error) {
+	if decrypted, err := codec.keys.open(data); err != nil {
+		return value, err
+	} else {
+		return codec.delegate.Decode(decrypted)
+	}
+}
+
+type encryptionFormat struct {
+	delegate Format
+	keys     *KeyRing
+}
+
+// EncryptionFormat encrypts the output of delegate, like EncryptionWrapperCodec
+func EncryptionFormat(delegate Format, keys *KeyRing) Format {
+	return encryptionFormat{delegate: delegate, keys: keys}
+}
+
+func (format encryptionFormat) Name() string {
+	return "aes-gcm+" + format.delegate.Name()
+}
+
+func (format encryptionFormat) Marshal(value any) ([]byte, error) {
+	if encoded, err := format.delegate.Marshal(value); err != nil {
+		return nil, err
+	} else {
+		return format.keys.seal(encoded)
+	}
+}
+
+func (format encryptionFormat) Unmarshal(data []byte, value any) error {
+	if decrypted, err := format.keys.open(data); err != nil {
+		return err
+	} else {
+		return format.delegate.Unmarshal(decrypted, value)
+	}
+}
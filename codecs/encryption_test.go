@@ -0,0 +1,69 @@
+package codecs
+
+import (
+	"bytes"
+	"errors"
+	"github.com/mwildt/goodb/utils/testutils"
+	"testing"
+)
+
+func testKeyRing(t *testing.T, current string) *KeyRing {
+	ring, err := NewKeyRing(current, map[string][]byte{
+		"k1": bytes.Repeat([]byte{1}, 32),
+		"k2": bytes.Repeat([]byte{2}, 16),
+	})
+	testutils.AssertNoError(t, err, "FEHLER")
+	return ring
+}
+
+func TestEncryptionWrapperCodec(t *testing.T) {
+	codec := NewEncryptionWrapperCodec[string](NewJsonCodec[string](), testKeyRing(t, "k1"))
+	testutils.Assert(t, codec.Name() == "aes-gcm+json", "unexpected name %s", codec.Name())
+
+	enc, err := codec.Encode("geheim")
+	testutils.AssertNoError(t, err, "FEHLER")
+	testutils.Assert(t, !bytes.Contains(enc, []byte("geheim")), "value has not been encrypted: %q", enc)
+	other, _ := codec.Encode("geheim")
+	testutils.Assert(t, !bytes.Equal(enc, other), "expected a random nonce per value")
+
+	decoded, err := codec.Decode(enc)
+	testutils.AssertNoError(t, err, "FEHLER")
+	testutils.Assert(t, decoded == "geheim", "expected decoded value, but got %s", decoded)
+
+	enc[len(enc)-1] ^= 1
+	_, err = codec.Decode(enc)
+	testutils.Assert(t, errors.Is(err, ErrDecryption), "expected ErrDecryption, but got %v", err)
+}
+
+func TestEncryptionWrapperCodec_KeyRotation(t *testing.T) {
+	old := NewEncryptionWrapperCodec[string](NewJsonCodec[string](), testKeyRing(t, "k1"))
+	enc, err := old.Encode("geheim")
+	testutils.AssertNoError(t, err, "FEHLER")
+
+	rotated := NewEncryptionWrapperCodec[string](NewJsonCodec[string](), testKeyRing(t, "k2"))
+	decoded, err := rotated.Decode(enc)
+	testutils.Assert(t, err == nil && decoded == "geheim", "value of the previous key could not be decoded (%v)", err)
+	enc, _ = rotated.Encode("geheim")
+	testutils.Assert(t, bytes.HasPrefix(enc, []byte("\x02k2")), "value has not been encrypted with the current key")
+
+	ring, err := NewKeyRing("k3", map[string][]byte{"k3": bytes.Repeat([]byte{3}, 32)})
+	testutils.AssertNoError(t, err, "FEHLER")
+	_, err = NewEncryptionWrapperCodec[string](NewJsonCodec[string](), ring).Decode(enc)
+	testutils.Assert(t, errors.Is(err, ErrUnknownKey), "expected ErrUnknownKey, but got %v", err)
+
+	_, err = NewKeyRing("k4", map[string][]byte{"k3": bytes.Repeat([]byte{3}, 32)})
+	testutils.Assert(t, errors.Is(err, ErrUnknownKey), "expected ErrUnknownKey, but got %v", err)
+	_, err = NewKeyRing("k3", map[string][]byte{"k3": []byte("zu kurz")})
+	testutils.Assert(t, err != nil, "invalid key size has been accepted")
+}
+
+func TestEncryptionFormat(t *testing.T) {
+	format := EncryptionFormat(JsonFormat(), testKeyRing(t, "k1"))
+	testutils.Assert(t, format.Name() == "aes-gcm+json", "unexpected name %s", format.Name())
+	codec := NewFormatCodec[[]string](format)
+	enc, err := codec.Encode([]string{"geheim"})
+	testutils.AssertNoError(t, err, "FEHLER")
+	testutils.Assert(t, !bytes.Contains(enc, []byte("geheim")), "value has not been encrypted: %q", enc)
+	decoded, err := codec.Decode(enc)
+	testutils.Assert(t, err == nil && len(decoded) == 1 && decoded[0] == "geheim", "unexpected decoded value %v (%v)", decoded, err)
+}
@@ -0,0 +1,115 @@
+package codecs
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Format is a serialization format for values of any type. Unlike a Codec it is not bound to a type, so it can be
+// chosen for types which are unknown to the caller, e.g. the records of a memtable log.
+type Format interface {
+	Named
+	Marshal(value any) ([]byte, error)
+	Unmarshal(data []byte, value any) error
+}
+
+// FormatCodec adapts a Format to a Codec
+type FormatCodec[T any] struct {
+	format Format
+}
+
+func NewFormatCodec[T any](format Format) *FormatCodec[T] {
+	return &FormatCodec[T]{format: format}
+}
+
+func (codec FormatCodec[T]) Name() string {
+	return codec.format.Name()
+}
+
+func (codec FormatCodec[T]) Encode(value T) ([]byte, error) {
+	return codec.format.Marshal(value)
+}
+
+func (codec FormatCodec[T]) Decode(data []byte) (value T, err error) {
+	err = codec.format.Unmarshal(data, &value)
+	return value, err
+}
+
+type jsonFormat struct{}
+
+// JsonFormat encodes values with encoding/json
+func JsonFormat() Format {
+	return jsonFormat{}
+}
+
+func (jsonFormat) Name() string {
+	return "json"
+}
+
+func (jsonFormat) Marshal(value any) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (jsonFormat) Unmarshal(data []byte, value any) error {
+	return json.Unmarshal(data, value)
+}
+
+type rawFormat struct{}
+
+// RawFormat passes byte slices through unchanged. It is the delegate of wrappers applied to data which is already
+// encoded, e.g. EncryptionFormat(RawFormat(), keys).
+func RawFormat() Format {
+	return rawFormat{}
+}
+
+func (rawFormat) Name() string {
+	return "raw"
+}
+
+func (rawFormat) Marshal(value any) ([]byte, error) {
+	if data, ok := value.([]byte); ok {
+		return data, nil
+	}
+	return nil, fmt.Errorf("raw format requires []byte, not %T", value)
+}
+
+func (rawFormat) Unmarshal(data []byte, value any) error {
+	if target, ok := value.(*[]byte); ok {
+		*target = data
+		return nil
+	}
+	return fmt.Errorf("raw format requires *[]byte, not %T", value)
+}
+
+type base64Format struct {
+	delegate Format
+	encoding *base64.Encoding
+}
+
+// Base64Format encodes the output of delegate with base64, like Base64WrapperCodec
+func Base64Format(delegate Format) Format {
+	return base64Format{delegate: delegate, encoding: base64.RawStdEncoding}
+}
+
+func (format base64Format) Name() string {
+	return "base64+" + format.delegate.Name()
+}
+
+func (format base64Format) Marshal(value any) ([]byte, error) {
+	if encoded, err := format.delegate.Marshal(value); err != nil {
+		return nil, err
+	} else {
+		data := make([]byte, format.encoding.EncodedLen(len(encoded)))
+		format.encoding.Encode(data, encoded)
+		return data, nil
+	}
+}
+
+func (format base64Format) Unmarshal(data []byte, value any) error {
+	decoded := make([]byte, format.encoding.DecodedLen(len(data)))
+	if _, err := format.encoding.Decode(decoded, data); err != nil {
+		return err
+	}
+	return format.delegate.Unmarshal(decoded, value)
+}
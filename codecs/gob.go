@@ -0,0 +1,50 @@
+package codecs
+
+import (
+	"bytes"
+	"encoding/gob"
+)
+
+// GobCodec encodes values with encoding/gob. Each value is encoded with its own encoder, so every encoded value
+// contains the type information it needs to be decoded on its own.
+type GobCodec[T any] struct{}
+
+func NewGobCodec[T any]() *GobCodec[T] {
+	return &GobCodec[T]{}
+}
+
+func (codec GobCodec[T]) Name() string {
+	return "gob"
+}
+
+func (codec GobCodec[T]) Encode(value T) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	err := gob.NewEncoder(&buffer).Encode(value)
+	return buffer.Bytes(), err
+}
+
+func (codec GobCodec[T]) Decode(data []byte) (value T, err error) {
+	err = gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+	return value, err
+}
+
+type gobFormat struct{}
+
+// GobFormat encodes values with encoding/gob, like GobCodec
+func GobFormat() Format {
+	return gobFormat{}
+}
+
+func (gobFormat) Name() string {
+	return "gob"
+}
+
+func (gobFormat) Marshal(value any) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	err := gob.NewEncoder(&buffer).Encode(value)
+	return buffer.Bytes(), err
+}
+
+func (gobFormat) Unmarshal(data []byte, value any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(value)
+}
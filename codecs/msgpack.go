@@ -0,0 +1,632 @@
+package codecs
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MsgpackCodec encodes values as MessagePack. Structs are encoded as maps of their exported fields, named by a
+// `msgpack:"name"` tag or the field name, fields tagged with "-" are skipped. time.Time is encoded with the
+// timestamp extension type and decoded in local time. Decoding into an empty interface results in nil, bool,
+// int64, uint64, float32, float64, string, []byte, time.Time, []any and map[string]any or map[any]any values.
+type MsgpackCodec[T any] struct{}
+
+func NewMsgpackCodec[T any]() *MsgpackCodec[T] {
+	return &MsgpackCodec[T]{}
+}
+
+func (codec MsgpackCodec[T]) Name() string {
+	return "msgpack"
+}
+
+func (codec MsgpackCodec[T]) Encode(value T) ([]byte, error) {
+	return appendMsgpack(make([]byte, 0, 64), reflect.ValueOf(&value).Elem())
+}
+
+func (codec MsgpackCodec[T]) Decode(data []byte) (value T, err error) {
+	decoder := msgpackDecoder{data}
+	if err = decoder.decode(reflect.ValueOf(&value).Elem()); err == nil && len(decoder.data) > 0 {
+		err = fmt.Errorf("%w: %d trailing bytes", ErrInvalidBinary, len(decoder.data))
+	}
+	return value, err
+}
+
+type msgpackFormat struct{}
+
+// MsgpackFormat encodes values as MessagePack, like MsgpackCodec. Unmarshal requires a non-nil pointer.
+func MsgpackFormat() Format {
+	return msgpackFormat{}
+}
+
+func (msgpackFormat) Name() string {
+	return "msgpack"
+}
+
+func (msgpackFormat) Marshal(value any) ([]byte, error) {
+	return appendMsgpack(make([]byte, 0, 64), reflect.ValueOf(value))
+}
+
+func (msgpackFormat) Unmarshal(data []byte, value any) error {
+	target := reflect.ValueOf(value)
+	if target.Kind() != reflect.Pointer || target.IsNil() {
+		return fmt.Errorf("msgpack: unmarshal into non-pointer %T", value)
+	}
+	decoder := msgpackDecoder{data}
+	if err := decoder.decode(target.Elem()); err != nil {
+		return err
+	} else if len(decoder.data) > 0 {
+		return fmt.Errorf("%w: %d trailing bytes", ErrInvalidBinary, len(decoder.data))
+	}
+	return nil
+}
+
+const (
+	msgpackNil       = 0xc0
+	msgpackFalse     = 0xc2
+	msgpackTrue      = 0xc3
+	msgpackTimestamp = -1 // extension type of timestamps
+)
+
+var timeType = reflect.TypeFor[time.Time]()
+
+type msgpackField struct {
+	name  string
+	index int
+}
+
+var msgpackFieldCache sync.Map // reflect.Type of a struct to its []msgpackField
+
+// msgpackFields returns the encoded fields of a struct type
+func msgpackFields(structType reflect.Type) []msgpackField {
+	if cached, ok := msgpackFieldCache.Load(structType); ok {
+		return cached.([]msgpackField)
+	}
+	fields := make([]msgpackField, 0, structType.NumField())
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("msgpack"), ",")
+		if field.IsExported() && name != "-" {
+			fields = append(fields, msgpackField{cmp.Or(name, field.Name), i})
+		}
+	}
+	msgpackFieldCache.Store(structType, fields)
+	return fields
+}
+
+func appendMsgpack(data []byte, value reflect.Value) (_ []byte, err error) {
+	if value.IsValid() && value.Type() == timeType {
+		return appendMsgpackTime(data, value.Interface().(time.Time)), nil
+	}
+	switch value.Kind() {
+	case reflect.Invalid:
+		return append(data, msgpackNil), nil
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return append(data, msgpackNil), nil
+		}
+		return appendMsgpack(data, value.Elem())
+	case reflect.Bool:
+		if value.Bool() {
+			return append(data, msgpackTrue), nil
+		}
+		return append(data, msgpackFalse), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendMsgpackInt(data, value.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return appendMsgpackUint(data, value.Uint()), nil
+	case reflect.Float32:
+		return binary.BigEndian.AppendUint32(append(data, 0xca), math.Float32bits(float32(value.Float()))), nil
+	case reflect.Float64:
+		return binary.BigEndian.AppendUint64(append(data, 0xcb), math.Float64bits(value.Float())), nil
+	case reflect.String:
+		data = appendMsgpackSize(data, value.Len(), 0xa0, 31, 0xd9, 0xda, 0xdb)
+		return append(data, value.String()...), nil
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.IsNil() {
+			return append(data, msgpackNil), nil
+		} else if value.Type().Elem().Kind() == reflect.Uint8 {
+			data = appendMsgpackSize(data, value.Len(), 0, -1, 0xc4, 0xc5, 0xc6)
+			for i := 0; i < value.Len(); i++ {
+				data = append(data, byte(value.Index(i).Uint()))
+			}
+			return data, nil
+		}
+		data = appendMsgpackSize(data, value.Len(), 0x90, 15, 0, 0xdc, 0xdd)
+		for i := 0; i < value.Len(); i++ {
+			if data, err = appendMsgpack(data, value.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	case reflect.Map:
+		if value.IsNil() {
+			return append(data, msgpackNil), nil
+		}
+		return appendMsgpackMap(data, value)
+	case reflect.Struct:
+		fields := msgpackFields(value.Type())
+		data = appendMsgpackSize(data, len(fields), 0x80, 15, 0, 0xde, 0xdf)
+		for _, field := range fields {
+			data = appendMsgpackSize(data, len(field.name), 0xa0, 31, 0xd9, 0xda, 0xdb)
+			data = append(data, field.name...)
+			if data, err = appendMsgpack(data, value.Field(field.index)); err != nil {
+				return nil, err
+			}
+		}
+		return data, nil
+	default:
+		return nil, fmt.Errorf("msgpack: unsupported type %s", value.Type())
+	}
+}
+
+// appendMsgpackMap appends the entries of a map ordered by their encoded keys, so equal maps are encoded equally
+func appendMsgpackMap(data []byte, value reflect.Value) (_ []byte, err error) {
+	type entry struct {
+		key   []byte
+		value reflect.Value
+	}
+	entries := make([]entry, 0, value.Len())
+	for iter := value.MapRange(); iter.Next(); {
+		key, err := appendMsgpack(nil, iter.Key())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry{key, iter.Value()})
+	}
+	slices.SortFunc(entries, func(a, b entry) int {
+		return bytes.Compare(a.key, b.key)
+	})
+	data = appendMsgpackSize(data, len(entries), 0x80, 15, 0, 0xde, 0xdf)
+	for _, e := range entries {
+		if data, err = appendMsgpack(append(data, e.key...), e.value); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// appendMsgpackSize appends the header of a string, binary, array or map of the given size. Sizes up to fixMax
+// are encoded in the fix format, a zero code marks a size class which does not exist for the type.
+func appendMsgpackSize(data []byte, size int, fixCode byte, fixMax int, code8, code16, code32 byte) []byte {
+	switch {
+	case size <= fixMax:
+		return append(data, fixCode|byte(size))
+	case code8 != 0 && size <= math.MaxUint8:
+		return append(data, code8, byte(size))
+	case size <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(data, code16), uint16(size))
+	default:
+		return binary.BigEndian.AppendUint32(append(data, code32), uint32(size))
+	}
+}
+
+func appendMsgpackInt(data []byte, value int64) []byte {
+	switch {
+	case value >= 0:
+		return appendMsgpackUint(data, uint64(value))
+	case value >= -32:
+		return append(data, byte(value))
+	case value >= math.MinInt8:
+		return append(data, 0xd0, byte(value))
+	case value >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(data, 0xd1), uint16(value))
+	case value >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(data, 0xd2), uint32(value))
+	default:
+		return binary.BigEndian.AppendUint64(append(data, 0xd3), uint64(value))
+	}
+}
+
+func appendMsgpackUint(data []byte, value uint64) []byte {
+	switch {
+	case value <= math.MaxInt8:
+		return append(data, byte(value))
+	case value <= math.MaxUint8:
+		return append(data, 0xcc, byte(value))
+	case value <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(data, 0xcd), uint16(value))
+	case value <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(data, 0xce), uint32(value))
+	default:
+		return binary.BigEndian.AppendUint64(append(data, 0xcf), value)
+	}
+}
+
+// appendMsgpackTime appends the smallest of the timestamp 32, 64 and 96 formats which can hold t
+func appendMsgpackTime(data []byte, t time.Time) []byte {
+	seconds, nanos := t.Unix(), uint64(t.Nanosecond())
+	switch {
+	case seconds >= 0 && seconds <= math.MaxUint32 && nanos == 0:
+		return binary.BigEndian.AppendUint32(append(data, 0xd6, byte(0xff)), uint32(seconds))
+	case seconds >= 0 && seconds < 1<<34:
+		return binary.BigEndian.AppendUint64(append(data, 0xd7, byte(0xff)), nanos<<34|uint64(seconds))
+	default:
+		data = binary.BigEndian.AppendUint32(append(data, 0xc7, 12, byte(0xff)), uint32(nanos))
+		return binary.BigEndian.AppendUint64(data, uint64(seconds))
+	}
+}
+
+type msgpackDecoder struct {
+	data []byte
+}
+
+func (d *msgpackDecoder) read(size int) ([]byte, error) {
+	if size < 0 || len(d.data) < size {
+		return nil, ErrInvalidBinary
+	}
+	value := d.data[:size:size]
+	d.data = d.data[size:]
+	return value, nil
+}
+
+// uint reads a big endian unsigned integer of 1, 2, 4 or 8 bytes
+func (d *msgpackDecoder) uint(size int) (uint64, error) {
+	value, err := d.read(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(value[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(value)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(value)), nil
+	default:
+		return binary.BigEndian.Uint64(value), nil
+	}
+}
+
+// length reads the size of a string, binary, array or map with size field of the given number of bytes. Each
+// element takes at least one byte, larger sizes are rejected before anything is allocated.
+func (d *msgpackDecoder) length(size int) (int, error) {
+	length, err := d.uint(size)
+	if err != nil {
+		return 0, err
+	} else if length > uint64(len(d.data)) {
+		return 0, ErrInvalidBinary
+	}
+	return int(length), nil
+}
+
+// header reads the header of an array or a map and returns its number of elements
+func (d *msgpackDecoder) header(fixCode byte, code16 byte) (int, error) {
+	code, err := d.uint(1)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case byte(code)&0xf0 == fixCode:
+		return int(code & 0x0f), nil
+	case byte(code) == code16:
+		return d.length(2)
+	case byte(code) == code16+1:
+		return d.length(4)
+	default:
+		return 0, fmt.Errorf("%w: unexpected code 0x%x", ErrInvalidBinary, code)
+	}
+}
+
+// decode decodes the next value into target
+func (d *msgpackDecoder) decode(target reflect.Value) error {
+	if len(d.data) == 0 {
+		return ErrInvalidBinary
+	} else if d.data[0] == msgpackNil {
+		d.data = d.data[1:]
+		target.SetZero()
+		return nil
+	}
+	switch target.Kind() {
+	case reflect.Pointer:
+		if target.IsNil() {
+			target.Set(reflect.New(target.Type().Elem()))
+		}
+		return d.decode(target.Elem())
+	case reflect.Slice, reflect.Array:
+		if target.Type().Elem().Kind() != reflect.Uint8 {
+			return d.decodeArray(target)
+		}
+	case reflect.Map:
+		return d.decodeMap(target)
+	case reflect.Struct:
+		if target.Type() != timeType {
+			return d.decodeStruct(target)
+		}
+	}
+	value, err := d.decodeAny()
+	if err != nil {
+		return err
+	}
+	return setMsgpackValue(target, value)
+}
+
+func (d *msgpackDecoder) decodeArray(target reflect.Value) error {
+	size, err := d.header(0x90, 0xdc)
+	if err != nil {
+		return err
+	} else if target.Kind() == reflect.Slice {
+		target.Set(reflect.MakeSlice(target.Type(), size, size))
+	} else {
+		target.SetZero()
+	}
+	for i := 0; i < size; i++ {
+		if i >= target.Len() {
+			_, err = d.decodeAny()
+		} else {
+			err = d.decode(target.Index(i))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *msgpackDecoder) decodeMap(target reflect.Value) error {
+	size, err := d.header(0x80, 0xde)
+	if err != nil {
+		return err
+	} else if target.IsNil() {
+		target.Set(reflect.MakeMapWithSize(target.Type(), size))
+	}
+	for i := 0; i < size; i++ {
+		key := reflect.New(target.Type().Key()).Elem()
+		value := reflect.New(target.Type().Elem()).Elem()
+		if err := d.decode(key); err != nil {
+			return err
+		} else if err := d.decode(value); err != nil {
+			return err
+		}
+		target.SetMapIndex(key, value)
+	}
+	return nil
+}
+
+// decodeStruct decodes a map into the fields of a struct, unknown keys are skipped
+func (d *msgpackDecoder) decodeStruct(target reflect.Value) error {
+	size, err := d.header(0x80, 0xde)
+	if err != nil {
+		return err
+	}
+	fields := msgpackFields(target.Type())
+	for i := 0; i < size; i++ {
+		key, err := d.decodeAny()
+		if err != nil {
+			return err
+		}
+		name, _ := key.(string)
+		if idx := slices.IndexFunc(fields, func(field msgpackField) bool { return field.name == name }); idx < 0 {
+			_, err = d.decodeAny()
+		} else {
+			err = d.decode(target.Field(fields[idx].index))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeAny decodes the next value into its natural Go type
+func (d *msgpackDecoder) decodeAny() (any, error) {
+	if len(d.data) == 0 {
+		return nil, ErrInvalidBinary
+	}
+	// arrays and maps are decoded including their header
+	switch c := d.data[0]; {
+	case c&0xf0 == 0x90, c == 0xdc, c == 0xdd:
+		values := make([]any, 0)
+		return values, d.decodeArray(reflect.ValueOf(&values).Elem())
+	case c&0xf0 == 0x80, c == 0xde, c == 0xdf:
+		return d.decodeAnyMap()
+	}
+	code, _ := d.uint(1)
+	switch c := byte(code); {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xe0 == 0xa0:
+		value, err := d.read(int(c & 0x1f))
+		return string(value), err
+	}
+	switch c := byte(code); c {
+	case msgpackNil:
+		return nil, nil
+	case msgpackFalse:
+		return false, nil
+	case msgpackTrue:
+		return true, nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		return d.uint(1 << (c - 0xcc))
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		value, err := d.uint(size)
+		shift := 64 - 8*size
+		return int64(value<<shift) >> shift, err
+	case 0xca:
+		value, err := d.uint(4)
+		return math.Float32frombits(uint32(value)), err
+	case 0xcb:
+		value, err := d.uint(8)
+		return math.Float64frombits(value), err
+	case 0xd9, 0xda, 0xdb:
+		value, err := d.readSized(1 << (c - 0xd9))
+		return string(value), err
+	case 0xc4, 0xc5, 0xc6:
+		value, err := d.readSized(1 << (c - 0xc4))
+		return bytes.Clone(value), err
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.decodeExtension(1 << (c - 0xd4))
+	case 0xc7, 0xc8, 0xc9:
+		size, err := d.length(1 << (c - 0xc7))
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeExtension(size)
+	default:
+		return nil, fmt.Errorf("%w: unexpected code 0x%x", ErrInvalidBinary, c)
+	}
+}
+
+// readSized reads a string or binary with a size field of the given number of bytes
+func (d *msgpackDecoder) readSized(size int) ([]byte, error) {
+	length, err := d.length(size)
+	if err != nil {
+		return nil, err
+	}
+	return d.read(length)
+}
+
+func (d *msgpackDecoder) decodeAnyMap() (any, error) {
+	size, err := d.header(0x80, 0xde)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[any]any, size)
+	stringKeys := true
+	for i := 0; i < size; i++ {
+		key, err := d.decodeAny()
+		if err != nil {
+			return nil, err
+		} else if key == nil || !reflect.TypeOf(key).Comparable() {
+			return nil, fmt.Errorf("%w: map key of type %T", ErrInvalidBinary, key)
+		} else if values[key], err = d.decodeAny(); err != nil {
+			return nil, err
+		}
+		_, isString := key.(string)
+		stringKeys = stringKeys && isString
+	}
+	if !stringKeys {
+		return values, nil
+	}
+	result := make(map[string]any, len(values))
+	for key, value := range values {
+		result[key.(string)] = value
+	}
+	return result, nil
+}
+
+// decodeExtension decodes an extension of the given size, only timestamps are supported
+func (d *msgpackDecoder) decodeExtension(size int) (any, error) {
+	extType, err := d.uint(1)
+	if err != nil {
+		return nil, err
+	} else if int8(extType) != msgpackTimestamp {
+		return nil, fmt.Errorf("%w: unsupported extension type %d", ErrInvalidBinary, int8(extType))
+	}
+	value, err := d.read(size)
+	if err != nil {
+		return nil, err
+	}
+	switch size {
+	case 4:
+		return time.Unix(int64(binary.BigEndian.Uint32(value)), 0), nil
+	case 8:
+		data := binary.BigEndian.Uint64(value)
+		return time.Unix(int64(data&(1<<34-1)), int64(data>>34)), nil
+	case 12:
+		return time.Unix(int64(binary.BigEndian.Uint64(value[4:])), int64(binary.BigEndian.Uint32(value))), nil
+	default:
+		return nil, fmt.Errorf("%w: timestamp of %d bytes", ErrInvalidBinary, size)
+	}
+}
+
+// setMsgpackValue assigns a decoded value to target, converting numbers to the type of target
+func setMsgpackValue(target reflect.Value, value any) error {
+	switch target.Kind() {
+	case reflect.Interface:
+		if target.NumMethod() > 0 {
+			return fmt.Errorf("msgpack: cannot decode into %s", target.Type())
+		}
+		target.Set(reflect.ValueOf(value))
+		return nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if number, ok := msgpackInt(value); ok && !target.OverflowInt(number) {
+			target.SetInt(number)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if number, ok := msgpackUint(value); ok && !target.OverflowUint(number) {
+			target.SetUint(number)
+			return nil
+		}
+	case reflect.Float32, reflect.Float64:
+		switch number := value.(type) {
+		case float32:
+			target.SetFloat(float64(number))
+			return nil
+		case float64:
+			target.SetFloat(number)
+			return nil
+		case int64:
+			target.SetFloat(float64(number))
+			return nil
+		case uint64:
+			target.SetFloat(float64(number))
+			return nil
+		}
+	case reflect.Bool:
+		if b, ok := value.(bool); ok {
+			target.SetBool(b)
+			return nil
+		}
+	case reflect.String:
+		switch s := value.(type) {
+		case string:
+			target.SetString(s)
+			return nil
+		case []byte:
+			target.SetString(string(s))
+			return nil
+		}
+	case reflect.Slice, reflect.Array:
+		data, ok := value.([]byte)
+		if s, isString := value.(string); isString {
+			data, ok = []byte(s), true
+		}
+		if ok && target.Kind() == reflect.Slice {
+			target.Set(reflect.MakeSlice(target.Type(), len(data), len(data)))
+		} else if ok && target.Len() >= len(data) {
+			target.SetZero()
+		} else {
+			break
+		}
+		reflect.Copy(target, reflect.ValueOf(data))
+		return nil
+	case reflect.Struct:
+		if t, ok := value.(time.Time); ok && target.Type() == timeType {
+			target.Set(reflect.ValueOf(t))
+			return nil
+		}
+	}
+	return fmt.Errorf("msgpack: cannot decode %T into %s", value, target.Type())
+}
+
+func msgpackInt(value any) (int64, bool) {
+	switch number := value.(type) {
+	case int64:
+		return number, true
+	case uint64:
+		return int64(number), number <= math.MaxInt64
+	}
+	return 0, false
+}
+
+func msgpackUint(value any) (uint64, bool) {
+	switch number := value.(type) {
+	case int64:
+		return uint64(number), number >= 0
+	case uint64:
+		return number, true
+	}
+	return 0, false
+}
@@ -0,0 +1,98 @@
+package codecs
+
+import (
+	"bytes"
+	"errors"
+	"github.com/mwildt/goodb/utils/testutils"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMsgpackCodec_Format(t *testing.T) {
+	expected := map[string]struct {
+		value   any
+		encoded []byte
+	}{
+		"nil":          {nil, []byte{0xc0}},
+		"true":         {true, []byte{0xc3}},
+		"fixint":       {1, []byte{0x01}},
+		"negative":     {-1, []byte{0xff}},
+		"uint16":       {256, []byte{0xcd, 0x01, 0x00}},
+		"int8":         {-100, []byte{0xd0, 0x9c}},
+		"float64":      {1.5, []byte{0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		"fixstr":       {"a", []byte{0xa1, 'a'}},
+		"bin":          {[]byte{1, 2}, []byte{0xc4, 0x02, 0x01, 0x02}},
+		"fixarray":     {[]int{1, 2}, []byte{0x92, 0x01, 0x02}},
+		"fixmap":       {map[string]int{"b": 2, "a": 1}, []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x02}},
+		"timestamp 32": {time.Unix(1, 0), []byte{0xd6, 0xff, 0, 0, 0, 1}},
+	}
+	codec := NewMsgpackCodec[any]()
+	for name, e := range expected {
+		encoded, err := codec.Encode(e.value)
+		testutils.AssertNoError(t, err, "FEHLER")
+		testutils.Assert(t, bytes.Equal(encoded, e.encoded), "%s: expected % x, but got % x", name, e.encoded, encoded)
+	}
+}
+
+type msgpackAddress struct {
+	Street string
+	Zip    uint32
+}
+
+type msgpackPerson struct {
+	Name     string `msgpack:"name"`
+	Age      int8
+	Score    float32
+	Tags     []string
+	Labels   map[string]int
+	Address  *msgpackAddress
+	Avatar   []byte
+	Born     time.Time
+	Internal string `msgpack:"-"`
+	Any      any
+}
+
+func TestMsgpackCodec(t *testing.T) {
+	codec := NewMsgpackCodec[msgpackPerson]()
+	person := msgpackPerson{
+		Name:     "Erika",
+		Age:      -42,
+		Score:    0.5,
+		Tags:     []string{"a", "b"},
+		Labels:   map[string]int{"x": 1 << 40},
+		Address:  &msgpackAddress{"Hauptstraße 1", 12345},
+		Avatar:   []byte{0, 1, 2},
+		Born:     time.Date(1990, 4, 1, 12, 30, 0, 123, time.UTC),
+		Internal: "geheim",
+		Any:      []any{"x", int64(1)},
+	}
+	enc, err := codec.Encode(person)
+	testutils.AssertNoError(t, err, "FEHLER")
+
+	decoded, err := codec.Decode(enc)
+	testutils.AssertNoError(t, err, "FEHLER")
+	testutils.Assert(t, decoded.Born.Equal(person.Born), "expected %v, but got %v", person.Born, decoded.Born)
+	decoded.Born, person.Born = time.Time{}, time.Time{}
+	person.Internal = ""
+	testutils.Assert(t, reflect.DeepEqual(decoded, person), "expected %+v, but got %+v", person, decoded)
+
+	generic, err := NewMsgpackCodec[map[string]any]().Decode(enc)
+	testutils.AssertNoError(t, err, "FEHLER")
+	testutils.Assert(t, generic["name"] == "Erika" && generic["Age"] == int64(-42), "unexpected generic decoding %v", generic)
+}
+
+func TestMsgpackCodec_Invalid(t *testing.T) {
+	codec := NewMsgpackCodec[msgpackPerson]()
+	enc, _ := codec.Encode(msgpackPerson{Name: "Erika", Tags: []string{"a"}})
+	for i := 0; i < len(enc); i++ {
+		_, err := codec.Decode(enc[:i])
+		testutils.Assert(t, err != nil, "truncated data of %d bytes has been decoded", i)
+	}
+	_, err := NewMsgpackCodec[int8]().Decode([]byte{0xcd, 0x01, 0x00})
+	testutils.Assert(t, err != nil, "overflow has not been detected")
+	_, err = codec.Decode([]byte{0xdd, 0xff, 0xff, 0xff, 0xff})
+	testutils.Assert(t, errors.Is(err, ErrInvalidBinary), "expected ErrInvalidBinary, but got %v", err)
+	_, err = NewMsgpackCodec[any]().Decode([]byte{0x81, 0xc0, 0x01})
+	testutils.Assert(t, errors.Is(err, ErrInvalidBinary), "expected ErrInvalidBinary for nil map key, but got %v", err)
+}
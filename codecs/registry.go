@@ -0,0 +1,105 @@
+package codecs
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"maps"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownCodec is returned by a Registry for names without registered format or wrapper
+var ErrUnknownCodec = errors.New("unknown codec")
+
+// Registry resolves codec names, like the ones recorded in log file headers, to formats. A name is a chain of
+// wrapper names ending with a format name, separated by "+", e.g. "gzip+base64+json" for JSON encoded, base64
+// wrapped and gzip compressed values. The zero value is an empty registry.
+type Registry struct {
+	mutex    sync.RWMutex
+	formats  map[string]func() Format
+	wrappers map[string]func(delegate Format) Format
+}
+
+// DefaultRegistry is used by log files which are opened without registry
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry creates a registry of the formats json, binary, gob, msgpack and raw and the wrappers base64, gzip
+// and flate
+func NewRegistry() *Registry {
+	registry := &Registry{}
+	registry.Register("json", JsonFormat)
+	registry.Register("binary", BinaryFormat)
+	registry.Register("gob", GobFormat)
+	registry.Register("msgpack", MsgpackFormat)
+	registry.Register("raw", RawFormat)
+	registry.RegisterWrapper("base64", Base64Format)
+	registry.RegisterWrapper("gzip", func(delegate Format) Format {
+		return CompressionFormat(delegate, GzipCompressor(gzip.DefaultCompression), 0)
+	})
+	registry.RegisterWrapper("flate", func(delegate Format) Format {
+		return CompressionFormat(delegate, FlateCompressor(flate.DefaultCompression), 0)
+	})
+	return registry
+}
+
+// Register adds the constructor of a format, the name must be the name of the constructed format
+func (registry *Registry) Register(name string, constructor func() Format) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if registry.formats == nil {
+		registry.formats = make(map[string]func() Format)
+	}
+	registry.formats[name] = constructor
+}
+
+// RegisterWrapper adds the constructor of a wrapper, e.g. a compression or encryption, around a delegate format.
+// The constructed format must be named name+"+"+delegate.Name().
+func (registry *Registry) RegisterWrapper(name string, constructor func(delegate Format) Format) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+	if registry.wrappers == nil {
+		registry.wrappers = make(map[string]func(Format) Format)
+	}
+	registry.wrappers[name] = constructor
+}
+
+// Clone returns a copy of the registry, which can be extended without changing the registry
+func (registry *Registry) Clone() *Registry {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	return &Registry{
+		formats:  maps.Clone(registry.formats),
+		wrappers: maps.Clone(registry.wrappers),
+	}
+}
+
+// Format constructs the format of the given name
+func (registry *Registry) Format(name string) (Format, error) {
+	registry.mutex.RLock()
+	defer registry.mutex.RUnlock()
+	parts := strings.Split(name, "+")
+	constructor, ok := registry.formats[parts[len(parts)-1]]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCodec, name)
+	}
+	format := constructor()
+	for i := len(parts) - 2; i >= 0; i-- {
+		if wrapper, ok := registry.wrappers[parts[i]]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownCodec, name)
+		} else {
+			format = wrapper(format)
+		}
+	}
+	return format, nil
+}
+
+// Lookup returns a codec of the format of the given name
+func Lookup[T any](registry *Registry, name string) (Codec[T], error) {
+	if format, err := registry.Format(name); err != nil {
+		return nil, err
+	} else {
+		return NewFormatCodec[T](format), nil
+	}
+}
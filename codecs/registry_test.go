@@ -0,0 +1,48 @@
+package codecs
+
+import (
+	"bytes"
+	"errors"
+	"github.com/mwildt/goodb/utils/testutils"
+	"testing"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	for _, name := range []string{"json", "gob", "msgpack", "base64+json", "gzip+base64+json", "flate+msgpack"} {
+		codec, err := Lookup[map[string]int](registry, name)
+		testutils.AssertNoError(t, err, "FEHLER")
+		testutils.Assert(t, NameOf(codec) == name, "expected codec %s, but got %s", name, NameOf(codec))
+		enc, err := codec.Encode(map[string]int{"eins": 1})
+		testutils.AssertNoError(t, err, "FEHLER")
+		decoded, err := codec.Decode(enc)
+		testutils.Assert(t, err == nil && decoded["eins"] == 1, "%s: unexpected decoded value %v (%v)", name, decoded, err)
+	}
+
+	// values encoded by the codecs are decoded by the registry codec of the same name
+	enc, _ := NewBase64JsonCodec[string]().Encode("TEST")
+	codec, _ := Lookup[string](registry, NameOf(NewBase64JsonCodec[string]()))
+	decoded, err := codec.Decode(enc)
+	testutils.Assert(t, err == nil && decoded == "TEST", "unexpected decoded value %s (%v)", decoded, err)
+
+	for _, name := range []string{"", "yaml", "zstd+json", "json+base64"} {
+		_, err := registry.Format(name)
+		testutils.Assert(t, errors.Is(err, ErrUnknownCodec), "%s: expected ErrUnknownCodec, but got %v", name, err)
+	}
+}
+
+func TestRegistry_RegisterWrapper(t *testing.T) {
+	keys, _ := NewKeyRing("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 16)})
+	registry := NewRegistry().Clone()
+	registry.RegisterWrapper("aes-gcm", func(delegate Format) Format {
+		return EncryptionFormat(delegate, keys)
+	})
+	codec, err := Lookup[string](registry, "aes-gcm+json")
+	testutils.AssertNoError(t, err, "FEHLER")
+	enc, _ := NewEncryptionWrapperCodec[string](NewJsonCodec[string](), keys).Encode("geheim")
+	decoded, err := codec.Decode(enc)
+	testutils.Assert(t, err == nil && decoded == "geheim", "unexpected decoded value %s (%v)", decoded, err)
+
+	_, err = DefaultRegistry.Format("aes-gcm+json")
+	testutils.Assert(t, errors.Is(err, ErrUnknownCodec), "wrapper of a clone has been added to the default registry")
+}
@@ -0,0 +1,17 @@
+// Contains helpers for durable file operations shared by the storage packages.
+package fsutil
+
+import (
+	"os"
+	"path"
+)
+
+// SyncDir syncs the directory containing filename, so the rename of the file survives a crash
+func SyncDir(filename string) error {
+	dir, err := os.Open(path.Dir(filename))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
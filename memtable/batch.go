@@ -0,0 +1,48 @@
+package memtable
+
+import (
+	"context"
+	"golang.org/x/exp/constraints"
+)
+
+// WriteBatch collects writes and deletes which are applied atomically by Memtable.Apply
+type WriteBatch[K constraints.Ordered, V any] struct {
+	mutations []mutation[K, V]
+}
+
+func NewWriteBatch[K constraints.Ordered, V any]() *WriteBatch[K, V] {
+	return &WriteBatch[K, V]{mutations: make([]mutation[K, V], 0)}
+}
+
+// Put adds a write of the key value pair to the batch
+func (b *WriteBatch[K, V]) Put(key K, value V) *WriteBatch[K, V] {
+	b.mutations = append(b.mutations, mutation[K, V]{Type: write, Key: key, Value: value})
+	return b
+}
+
+// Delete adds the removal of key to the batch
+func (b *WriteBatch[K, V]) Delete(key K) *WriteBatch[K, V] {
+	b.mutations = append(b.mutations, mutation[K, V]{Type: delete, Key: key})
+	return b
+}
+
+// Len returns the number of operations in the batch
+func (b *WriteBatch[K, V]) Len() int {
+	return len(b.mutations)
+}
+
+// Reset removes all operations from the batch
+func (b *WriteBatch[K, V]) Reset() {
+	b.mutations = b.mutations[:0]
+}
+
+// Apply writes all operations of the batch as a single record to the log and applies them to the index in
+// the order they have been added. On replay a batch is either applied completely or not at all.
+func (mt *Memtable[K, V]) Apply(ctx context.Context, batch *WriteBatch[K, V]) error {
+	if batch.Len() == 0 {
+		return nil
+	}
+	return mt.write(ctx, func() ([]mutation[K, V], error) {
+		return batch.mutations, nil
+	})
+}
@@ -0,0 +1,46 @@
+package memtable
+
+import (
+	"context"
+	"github.com/mwildt/goodb/utils/testutils"
+	"testing"
+)
+
+func TestApplyWriteBatch(t *testing.T) {
+	testutils.RunWithTempDir("TestApplyWriteBatch", func(dir string) {
+		mt, err := CreateMemtable[string, string]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), "old", "record")
+
+		batch := NewWriteBatch[string, string]().Put("new", "record").Delete("old").Put("other", "value")
+		err = mt.Apply(context.Background(), batch)
+		testutils.AssertNoError(t, err, "Fehler beim anwenden des batch")
+		testutils.Assert(t, mt.log.MessageCount() == 2, "expected 2 log records, but got %d", mt.log.MessageCount())
+
+		_, found := mt.Get("old")
+		testutils.Assert(t, !found, "key old was not deleted")
+		value, _ := mt.Get("new")
+		testutils.Assert(t, value == "record", "expected new to be record, but was %s", value)
+		mt.Close()
+
+		reopend, err := CreateMemtable[string, string]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		testutils.Assert(t, reopend.Size() == 2, "expected 2 entries, but got %d", reopend.Size())
+		_, found = reopend.Get("old")
+		testutils.Assert(t, !found, "key old was restored")
+		value, _ = reopend.Get("other")
+		testutils.Assert(t, value == "value", "expected other to be value, but was %s", value)
+		reopend.Close()
+	})
+}
+
+func TestApplyEmptyWriteBatch(t *testing.T) {
+	testutils.RunWithTempDir("TestApplyEmptyWriteBatch", func(dir string) {
+		mt, err := CreateMemtable[string, string]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		err = mt.Apply(context.Background(), NewWriteBatch[string, string]())
+		testutils.AssertNoError(t, err, "Fehler beim anwenden des batch")
+		testutils.Assert(t, mt.log.MessageCount() == 0, "expected no log record, but got %d", mt.log.MessageCount())
+		mt.Close()
+	})
+}
@@ -0,0 +1,182 @@
+package memtable
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mwildt/goodb/codecs"
+	"github.com/mwildt/goodb/messagelog"
+	"golang.org/x/exp/constraints"
+	"strings"
+)
+
+// defaultRecordFormat is the format of new logs
+func defaultRecordFormat() codecs.Format {
+	return codecs.BinaryFormat()
+}
+
+// legacyRecordFormat is the format of logs written before log files had headers
+func legacyRecordFormat() codecs.Format {
+	return codecs.Base64Format(codecs.JsonFormat())
+}
+
+// encryptionWrapper is the name of codecs.EncryptionFormat in format names
+const encryptionWrapper = "aes-gcm"
+
+// detectCodecs returns the record format and value codec of an existing log, which are resolved by the registry of
+// the configuration. For new logs the given format and value codec are returned. A value codec set by
+// WithValueCodec is kept, a mismatch is reported when the log is opened.
+func detectCodecs[K constraints.Ordered, V any](filename string, format codecs.Format, valueCodec codecs.Codec[V], config memtableConfiguration) (codecs.Format, codecs.Codec[V], error) {
+	name, found, err := messagelog.ReadCodecName(filename, config.logOptions()...)
+	if !found || errors.Is(err, messagelog.ErrTruncatedRecord) {
+		return format, valueCodec, nil
+	} else if err != nil {
+		return nil, nil, err
+	} else if name == "" {
+		return legacyRecordFormat(), valueCodec, nil
+	} else if name == newMessageCodec[K](format, valueCodec).Name() {
+		return format, valueCodec, nil
+	}
+	formatName, valueCodecName, _ := strings.Cut(name, "/")
+	registry := config.codecRegistry()
+	if format, err = registry.Format(formatName); err != nil {
+		return nil, nil, err
+	}
+	if config.valueCodec == nil && valueCodecName != codecs.NameOf(valueCodec) {
+		if valueCodec, err = codecs.Lookup[V](registry, valueCodecName); err != nil {
+			return nil, nil, err
+		}
+	}
+	return format, valueCodec, nil
+}
+
+// encrypted reports whether records of the format are encrypted
+func encrypted(format codecs.Format) bool {
+	return strings.HasPrefix(format.Name(), encryptionWrapper+"+")
+}
+
+// convertLog copies the records of the current log of frs to the next log file, which is written with
+// targetOptions, replaces the current log with it in the manifest and deletes the current log
+func convertLog[K constraints.Ordered](frs *fileRotationSequence, manifest *manifest, sourceOptions, targetOptions []messagelog.Option) error {
+	source, err := messagelog.NewMessageLog[memtableMessage[K, []byte]](frs.CurrentFilename(), sourceOptions...)
+	if err != nil {
+		return err
+	}
+	target, err := messagelog.NewMessageLog[memtableMessage[K, []byte]](frs.NextFilename(), targetOptions...)
+	if err != nil {
+		source.Close()
+		return err
+	}
+	defer target.Close()
+	if _, err = target.Open(messagelog.Noop[memtableMessage[K, []byte]]()); err != nil {
+		source.Close()
+		return err
+	}
+	_, err = source.Open(func(ctx context.Context, message memtableMessage[K, []byte]) error {
+		return target.Append(ctx, message)
+	})
+	source.Close()
+	if err != nil {
+		return err
+	} else if err = target.Sync(); err != nil {
+		return err
+	} else if err = manifest.apply([]string{target.GetFilename()}, []string{source.GetFilename()}); err != nil {
+		return err
+	}
+	source.Delete()
+	return nil
+}
+
+// messageCodec encodes log records with the configured format. Its name combines the record format and the value
+// codec, so both are recorded in the log header.
+type messageCodec[K constraints.Ordered] struct {
+	codecs.Codec[memtableMessage[K, []byte]]
+	name string
+}
+
+func newMessageCodec[K constraints.Ordered](format codecs.Format, valueCodec any) messageCodec[K] {
+	return messageCodec[K]{
+		Codec: codecs.NewFormatCodec[memtableMessage[K, []byte]](format),
+		name:  fmt.Sprintf("%s/%s", format.Name(), codecs.NameOf(valueCodec)),
+	}
+}
+
+func (codec messageCodec[K]) Name() string {
+	return codec.name
+}
+
+// valueCodec returns the configured value codec or the default JSON codec
+func valueCodec[V any](config memtableConfiguration) (codecs.Codec[V], error) {
+	if config.valueCodec == nil {
+		return codecs.NewJsonCodec[V](), nil
+	} else if codec, ok := config.valueCodec.(codecs.Codec[V]); ok {
+		return codec, nil
+	}
+	return nil, fmt.Errorf("value codec %T does not encode %T", config.valueCodec, *new(V))
+}
+
+// MarshalBinary encodes the message for codecs.BinaryFormat: the entry type, the key, sequence, timestamp, version
+// and expiry as varints, the length prefixed value and the nested messages of a batch.
+func (message memtableMessage[K, V]) MarshalBinary() ([]byte, error) {
+	return message.appendBinary(make([]byte, 0, 32))
+}
+
+func (message memtableMessage[K, V]) appendBinary(data []byte) (_ []byte, err error) {
+	value, ok := any(message.Value).([]byte)
+	if !ok {
+		return nil, fmt.Errorf("binary encoding requires []byte values, not %T", message.Value)
+	}
+	data = append(data, byte(message.Type))
+	data = codecs.AppendOrdered(data, message.Key)
+	data = binary.AppendUvarint(data, message.Sequence)
+	data = binary.AppendVarint(data, message.Timestamp)
+	data = binary.AppendUvarint(data, message.Version)
+	data = binary.AppendVarint(data, message.ExpiresAt)
+	data = codecs.AppendBytes(data, value)
+	data = binary.AppendUvarint(data, uint64(len(message.Batch)))
+	for _, nested := range message.Batch {
+		if data, err = nested.appendBinary(data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// UnmarshalBinary decodes a message encoded with MarshalBinary
+func (message *memtableMessage[K, V]) UnmarshalBinary(data []byte) error {
+	decoder := codecs.NewBinaryDecoder(data)
+	if err := message.readBinary(decoder); err != nil {
+		return err
+	} else if decoder.Remaining() > 0 {
+		return fmt.Errorf("%w: %d trailing bytes", codecs.ErrInvalidBinary, decoder.Remaining())
+	}
+	return nil
+}
+
+func (message *memtableMessage[K, V]) readBinary(decoder *codecs.BinaryDecoder) error {
+	message.Type = entryType(decoder.Byte())
+	message.Key = codecs.DecodeOrdered[K](decoder)
+	message.Sequence = decoder.Uvarint()
+	message.Timestamp = decoder.Varint()
+	message.Version = decoder.Uvarint()
+	message.ExpiresAt = decoder.Varint()
+	value, ok := any(&message.Value).(*[]byte)
+	if !ok {
+		return fmt.Errorf("binary encoding requires []byte values, not %T", message.Value)
+	}
+	*value = decoder.Bytes()
+	count := decoder.Uvarint()
+	if count > uint64(decoder.Remaining()) {
+		return codecs.ErrInvalidBinary
+	}
+	message.Batch = nil
+	for i := uint64(0); i < count; i++ {
+		nested := memtableMessage[K, V]{}
+		if err := nested.readBinary(decoder); err != nil {
+			return err
+		}
+		message.Batch = append(message.Batch, nested)
+	}
+	return decoder.Err()
+}
@@ -0,0 +1,171 @@
+package memtable
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"github.com/mwildt/goodb/codecs"
+	"github.com/mwildt/goodb/messagelog"
+	"github.com/mwildt/goodb/utils/testutils"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithCodec(t *testing.T) {
+	testutils.RunWithTempDir("TestWithCodec", func(dir string) {
+		options := []ConfigOption{
+			WithDatadir(dir),
+			WithCodec(codecs.JsonFormat()),
+			WithValueCodec(codecs.NewBase64JsonCodec[string]()),
+		}
+		mt, err := CreateMemtable[int, string]("testmt", options...)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), 1, "eins")
+		mt.Close()
+
+		reopend, err := CreateMemtable[int, string]("testmt", options...)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		value, _ := reopend.Get(1)
+		testutils.Assert(t, value == "eins", "expected eins, but got %s", value)
+		reopend.Close()
+
+		_, err = CreateMemtable[int, string]("testmt", WithDatadir(dir), WithCodec(codecs.JsonFormat()))
+		testutils.Assert(t, errors.Is(err, messagelog.ErrCodecMismatch), "expected ErrCodecMismatch, but got %v", err)
+
+		_, err = CreateMemtable[int, int]("testmt", WithDatadir(dir), WithValueCodec(codecs.NewJsonCodec[string]()))
+		testutils.Assert(t, err != nil, "value codec of another type has been accepted")
+	})
+}
+
+func TestSelectCodecs(t *testing.T) {
+	testutils.RunWithTempDir("TestSelectCodecs", func(dir string) {
+		format := codecs.CompressionFormat(codecs.MsgpackFormat(), codecs.GzipCompressor(gzip.BestSpeed), 0)
+		mt, err := CreateMemtable[int, DataV1]("testmt", WithDatadir(dir), WithCodec(format), WithValueCodec(codecs.NewGobCodec[DataV1]()))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), 1, DataV1{Name: "eins"})
+		mt.Close()
+
+		// format and value codec are selected by the names in the log header
+		reopend, err := CreateMemtable[int, DataV1]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		value, _ := reopend.Get(1)
+		testutils.Assert(t, value.Name == "eins", "expected eins, but got %s", value.Name)
+		reopend.Set(context.Background(), 2, DataV1{Name: "zwei"})
+		testutils.AssertNoError(t, reopend.compact(), "Fehler beim kompaktieren")
+		reopend.Close()
+
+		content, _ := os.ReadFile(reopend.log.GetFilename())
+		testutils.Assert(t, bytes.Contains(content, []byte("binary/gob")), "compacted log has not been written with the binary format")
+		compacted, err := CreateMemtable[int, DataV1]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		testutils.Assert(t, compacted.Size() == 2, "expected 2 entries, but got %d", compacted.Size())
+		compacted.Close()
+
+		_, err = CreateMemtable[int, DataV1]("testmt", WithDatadir(dir), WithCodecRegistry(&codecs.Registry{}))
+		testutils.Assert(t, errors.Is(err, codecs.ErrUnknownCodec), "expected ErrUnknownCodec, but got %v", err)
+	})
+}
+
+func TestBinaryRecords(t *testing.T) {
+	testutils.RunWithTempDir("TestBinaryRecords", func(dir string) {
+		mt, err := CreateMemtable[string, int]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), "eins", 1)
+		batch := NewWriteBatch[string, int]()
+		batch.Put("zwei", 2)
+		batch.Put("drei", 3)
+		batch.Delete("eins")
+		mt.Apply(context.Background(), batch)
+		mt.SetWithTTL(context.Background(), "vier", 4, time.Hour)
+		mt.Close()
+
+		content, _ := os.ReadFile(mt.log.GetFilename())
+		testutils.Assert(t, strings.Contains(string(content), "binary/json"), "log has not been written with the binary format")
+
+		reopend, err := CreateMemtable[string, int]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		testutils.Assert(t, reopend.Size() == 3, "expected 3 entries, but got %d", reopend.Size())
+		value, meta, _ := reopend.GetWithMeta("vier")
+		testutils.Assert(t, value == 4 && !meta.ExpiresAt.IsZero(), "unexpected value %d with meta %v", value, meta)
+		reopend.Close()
+	})
+}
+
+func TestLegacyJsonLog(t *testing.T) {
+	testutils.RunWithTempDir("TestLegacyJsonLog", func(dir string) {
+		mt, err := CreateMemtable[int, string]("testmt", WithDatadir(dir), WithCodec(codecs.Base64Format(codecs.JsonFormat())))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), 1, "eins")
+		mt.Set(context.Background(), 2, "zwei")
+		mt.Close()
+
+		// logs written before headers were introduced start with the first record
+		filename := mt.log.GetFilename()
+		content, _ := os.ReadFile(filename)
+		os.WriteFile(filename, content[bytes.Index(content, []byte("/json"))+len("/json"):], 0644)
+
+		reopend, err := CreateMemtable[int, string]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		testutils.Assert(t, reopend.Size() == 2, "expected 2 entries, but got %d", reopend.Size())
+		reopend.Set(context.Background(), 3, "drei")
+		testutils.AssertNoError(t, reopend.compact(), "Fehler beim kompaktieren")
+		reopend.Close()
+
+		content, _ = os.ReadFile(reopend.log.GetFilename())
+		testutils.Assert(t, bytes.Contains(content, []byte("binary/json")), "compacted log has not been written with the binary format")
+		compacted, err := CreateMemtable[int, string]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		value, _ := compacted.Get(1)
+		testutils.Assert(t, compacted.Size() == 3 && value == "eins", "unexpected memtable after compaction")
+		compacted.Close()
+	})
+}
+
+func TestWithEncryption(t *testing.T) {
+	testutils.RunWithTempDir("TestWithEncryption", func(dir string) {
+		mt, err := CreateMemtable[string, DataV1]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), "alice", DataV1{Name: "geheim"})
+		mt.Close()
+
+		keys, _ := codecs.NewKeyRing("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+		migration := WithMigration("length", "V__1", func(obj MigrationObject) (MigrationObject, error) {
+			obj["Length"] = len(obj["Name"].(string))
+			return obj, nil
+		})
+		encrypted, err := CreateMemtable[string, DataV1]("testmt", WithDatadir(dir), WithEncryption(keys), migration)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		encrypted.Set(context.Background(), "bob", DataV1{Name: "geheimer"})
+		encrypted.Close()
+
+		files, _ := os.ReadDir(dir)
+		for _, file := range files {
+			content, _ := os.ReadFile(path.Join(dir, file.Name()))
+			testutils.Assert(t, !bytes.Contains(content, []byte("geheim")), "%s contains unencrypted data", file.Name())
+			testutils.Assert(t, !bytes.Contains(content, []byte("alice")), "%s contains unencrypted keys", file.Name())
+		}
+
+		// the rotated key is used for new records, records of the previous key are still readable
+		rotated, _ := codecs.NewKeyRing("k2", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32), "k2": bytes.Repeat([]byte{2}, 32)})
+		reopend, err := CreateMemtable[string, DataV1]("testmt", WithDatadir(dir), WithEncryption(rotated), migration)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		value, _ := reopend.Get("alice")
+		testutils.Assert(t, value.Name == "geheim" && reopend.Size() == 2, "unexpected memtable after key rotation")
+		testutils.AssertNoError(t, reopend.compact(), "Fehler beim kompaktieren")
+		reopend.Close()
+
+		withoutOldKey, _ := codecs.NewKeyRing("k2", map[string][]byte{"k2": bytes.Repeat([]byte{2}, 32)})
+		compacted, err := CreateMemtable[string, DataV1]("testmt", WithDatadir(dir), WithEncryption(withoutOldKey), migration)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		value, _ = compacted.Get("bob")
+		testutils.Assert(t, value.Name == "geheimer" && compacted.Size() == 2, "unexpected memtable after compaction")
+		compacted.Close()
+
+		_, err = CreateMemtable[string, DataV1]("testmt", WithDatadir(dir))
+		testutils.Assert(t, errors.Is(err, codecs.ErrUnknownCodec), "expected ErrUnknownCodec, but got %v", err)
+	})
+}
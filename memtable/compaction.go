@@ -0,0 +1,272 @@
+package memtable
+
+import (
+	"cmp"
+	"fmt"
+	"github.com/mwildt/goodb/base"
+	"github.com/mwildt/goodb/sstable"
+	"golang.org/x/exp/constraints"
+	"iter"
+	"log"
+	"os"
+	"slices"
+	"time"
+)
+
+const (
+	levelMultiplier = 10 // growth of the max size from one level to the next
+	maxLevels       = 7
+	maxTieredTables = 32 // max number of tables merged by a size-tiered compaction
+)
+
+// CompactionStrategy selects the tables which are merged by the compaction of the tables of a memtable. A
+// compaction merges the entries of its tables into new tables, older versions of a key are dropped. Deletes and
+// expired records are dropped as soon as no older table may contain the key.
+type CompactionStrategy struct {
+	leveled       bool
+	l0Tables      int   // leveled: number of tables in level 0 which triggers their compaction
+	baseLevelSize int64 // leveled: max size of level 1 in bytes
+	tableSize     int64 // leveled: size of the tables of level 1 and above
+	minTables     int   // size-tiered: min number of similar sized tables merged
+}
+
+// LeveledCompaction organizes the tables in levels. Level 0 holds the flushed tables, which may overlap. When it
+// contains l0Tables tables, they are merged with the overlapping tables of level 1. The tables of level 1 and above
+// do not overlap and are split at tableSize bytes. When a level exceeds its max size, which is baseLevelSize for
+// level 1 and grows by factor 10 per level, its oldest table is merged into the next level. A read searches at most
+// l0Tables tables of level 0 and one table of each further level.
+func LeveledCompaction(l0Tables int, baseLevelSize, tableSize int64) CompactionStrategy {
+	return CompactionStrategy{leveled: true, l0Tables: max(l0Tables, 1), baseLevelSize: baseLevelSize, tableSize: tableSize}
+}
+
+// SizeTieredCompaction merges minTables or more tables of similar size, which have been written one after another,
+// into a single table. It rewrites the data less often than LeveledCompaction, but reads search more tables and
+// the merged tables grow without limit.
+func SizeTieredCompaction(minTables int) CompactionStrategy {
+	return CompactionStrategy{minTables: max(minTables, 2)}
+}
+
+// compactionPlan is a compaction selected by a CompactionStrategy
+type compactionPlan[K constraints.Ordered] struct {
+	inputs    []*lsmTable[K] // merged tables in read order
+	level     int            // level of the written tables
+	tableSize int64          // size at which the written tables are split, 0 writes a single table
+	bottom    bool           // no older table overlaps the inputs, deletes and expired records are dropped
+}
+
+// planCompaction returns the next compaction of tables, which are given in read order, or nil
+func planCompaction[K constraints.Ordered](strategy CompactionStrategy, tables []*lsmTable[K]) (plan *compactionPlan[K]) {
+	if strategy.leveled {
+		plan = planLeveled(strategy, tables)
+	} else {
+		plan = planSizeTiered(strategy, tables)
+	}
+	if plan != nil {
+		first, last := keyRange(plan.inputs)
+		plan.bottom = !slices.ContainsFunc(tables, func(table *lsmTable[K]) bool {
+			return !slices.Contains(plan.inputs, table) && compareTables(table, plan.inputs[0]) > 0 && table.overlaps(first, last)
+		})
+	}
+	return plan
+}
+
+func planLeveled[K constraints.Ordered](strategy CompactionStrategy, tables []*lsmTable[K]) *compactionPlan[K] {
+	levels := make([][]*lsmTable[K], maxLevels)
+	for _, table := range tables {
+		level := min(table.meta.level, maxLevels-1)
+		levels[level] = append(levels[level], table)
+	}
+	if len(levels[0]) >= strategy.l0Tables {
+		first, last := keyRange(levels[0])
+		return &compactionPlan[K]{inputs: append(levels[0], overlapping(levels[1], first, last)...), level: 1, tableSize: strategy.tableSize}
+	}
+	limit := strategy.baseLevelSize
+	for level := 1; level < maxLevels-1; level++ {
+		size := int64(0)
+		for _, table := range levels[level] {
+			size += table.Size()
+		}
+		if size > limit {
+			oldest := slices.MinFunc(levels[level], func(a, b *lsmTable[K]) int { return cmp.Compare(a.number, b.number) })
+			first, last := keyRange([]*lsmTable[K]{oldest})
+			inputs := append([]*lsmTable[K]{oldest}, overlapping(levels[level+1], first, last)...)
+			return &compactionPlan[K]{inputs: inputs, level: level + 1, tableSize: strategy.tableSize}
+		}
+		limit *= levelMultiplier
+	}
+	return nil
+}
+
+func planSizeTiered[K constraints.Ordered](strategy CompactionStrategy, tables []*lsmTable[K]) *compactionPlan[K] {
+	level0 := slices.Clone(tables)
+	level0 = slices.DeleteFunc(level0, func(table *lsmTable[K]) bool { return table.meta.level > 0 })
+	for start := range level0 {
+		end, total := start+1, level0[start].Size()
+		for end < len(level0) && end-start < maxTieredTables {
+			average, size := total/int64(end-start), level0[end].Size()
+			if size < average/2 || size > average*3/2 {
+				break
+			}
+			total += size
+			end++
+		}
+		if end-start >= strategy.minTables {
+			return &compactionPlan[K]{inputs: level0[start:end]}
+		}
+	}
+	return nil
+}
+
+// keyRange returns the smallest and the greatest key of tables
+func keyRange[K constraints.Ordered](tables []*lsmTable[K]) (first, last K) {
+	for i, table := range tables {
+		tableFirst, _ := table.First()
+		tableLast, _ := table.Last()
+		if i == 0 || tableFirst < first {
+			first = tableFirst
+		}
+		if i == 0 || tableLast > last {
+			last = tableLast
+		}
+	}
+	return first, last
+}
+
+// overlapping returns the tables which contain keys between first and last
+func overlapping[K constraints.Ordered](tables []*lsmTable[K], first, last K) []*lsmTable[K] {
+	result := make([]*lsmTable[K], 0)
+	for _, table := range tables {
+		if table.overlaps(first, last) {
+			result = append(result, table)
+		}
+	}
+	return result
+}
+
+// compactTables runs compactions in the background until the strategy selects no further tables. Compactions
+// don't block writers, they are serialized by mt.compactionMutex.
+func (mt *Memtable[K, V]) compactTables() error {
+	mt.compactionMutex.Lock()
+	defer mt.compactionMutex.Unlock()
+	for !mt.stopped() {
+		plan := planCompaction(mt.compaction, mt.snapshotTables())
+		if plan == nil {
+			return nil
+		} else if err := mt.runCompaction(plan); err != nil {
+			log.Printf("[memtable] compaction of %s failed: %v\n", mt.name, err)
+			return err
+		}
+	}
+	return nil
+}
+
+func (mt *Memtable[K, V]) stopped() bool {
+	select {
+	case <-mt.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// runCompaction merges the inputs of plan into new tables and replaces the inputs with them in a single edit of the
+// manifest. Tables written by an interrupted compaction are not live and are removed as orphans.
+func (mt *Memtable[K, V]) runCompaction(plan *compactionPlan[K]) (err error) {
+	meta := tableMetadata{level: plan.level, migrations: mt.migrations}
+	var readErr error
+	seqs := make([]iter.Seq2[K, []byte], len(plan.inputs))
+	for i, table := range plan.inputs {
+		seqs[i] = tableEntries(table, &readErr)
+		meta.sequence = max(meta.sequence, table.meta.sequence)
+	}
+
+	writers, numbers, outputs := make([]*sstable.Writer[K], 0), make([]int, 0), make([]*lsmTable[K], 0)
+	defer func() {
+		if err != nil {
+			for i, writer := range writers {
+				writer.Abort()
+				os.Remove(tableFilename(mt.frs.basedir, mt.name, numbers[i]))
+			}
+			for _, table := range outputs {
+				table.Close()
+			}
+		}
+	}()
+	now, count := time.Now(), 0
+	for key, data := range base.Merge(false, seqs...) {
+		if count++; count%1024 == 0 && mt.stopped() {
+			return ErrClosed
+		}
+		if plan.bottom {
+			if live, err := liveEntry[K](data, now); err != nil {
+				return err
+			} else if !live {
+				continue
+			}
+		}
+		if len(writers) == 0 || (plan.tableSize > 0 && writers[len(writers)-1].Size() >= plan.tableSize) {
+			n := mt.tableFiles.Increase()
+			writer, err := sstable.NewWriter[K](tableFilename(mt.frs.basedir, mt.name, n), mt.tableOptions...)
+			if err != nil {
+				return err
+			}
+			writers, numbers = append(writers, writer), append(numbers, n)
+		}
+		if err = writers[len(writers)-1].Add(key, data); err != nil {
+			return err
+		}
+	}
+	if readErr != nil {
+		return readErr
+	}
+	for _, writer := range writers {
+		writer.SetMetadata(meta.encode())
+		if err = writer.Close(); err != nil {
+			return err
+		}
+	}
+	for _, n := range numbers {
+		table, err := mt.openTable(n)
+		if err != nil {
+			return err
+		}
+		outputs = append(outputs, table)
+	}
+	added, removed := make([]string, len(outputs)), make([]string, len(plan.inputs))
+	for i, table := range outputs {
+		added[i] = table.Filename()
+	}
+	for i, table := range plan.inputs {
+		removed[i] = table.Filename()
+	}
+	if err = mt.manifest.apply(added, removed); err != nil {
+		return err
+	}
+	mt.replaceTables(plan.inputs, outputs)
+	log.Printf("[memtable] compacted %d tables of %s into %d tables of level %d\n", len(plan.inputs), mt.name, len(outputs), plan.level)
+	return nil
+}
+
+// tableEntries returns the entries of a table as key value pairs. A read error ends the iteration and is stored
+// in err.
+func tableEntries[K constraints.Ordered](table *lsmTable[K], err *error) iter.Seq2[K, []byte] {
+	return func(yield func(K, []byte) bool) {
+		for entry, readErr := range table.All() {
+			if readErr != nil {
+				*err = fmt.Errorf("%s: %w", table.Filename(), readErr)
+				return
+			} else if !yield(entry.Key, entry.Value) {
+				return
+			}
+		}
+	}
+}
+
+// liveEntry reports whether a table entry is neither a delete nor expired
+func liveEntry[K constraints.Ordered](data []byte, now time.Time) (bool, error) {
+	message := memtableMessage[K, []byte]{}
+	if err := message.UnmarshalBinary(data); err != nil {
+		return false, err
+	}
+	return message.Type != delete && (message.ExpiresAt == 0 || now.UnixNano() < message.ExpiresAt), nil
+}
@@ -0,0 +1,162 @@
+package memtable
+
+import (
+	"context"
+	"fmt"
+	"github.com/mwildt/goodb/utils/testutils"
+	"os"
+	"slices"
+	"testing"
+)
+
+// assertLevels checks that the tables of level 1 and above do not overlap
+func assertLevels(t *testing.T, tables []*lsmTable[int]) {
+	for i, a := range tables {
+		for _, b := range tables[i+1:] {
+			first, last := keyRange([]*lsmTable[int]{b})
+			testutils.Assert(t, a.meta.level == 0 || a.meta.level != b.meta.level || !a.overlaps(first, last), "tables %d and %d of level %d overlap", a.number, b.number, a.meta.level)
+		}
+	}
+}
+
+func TestCompaction_Leveled(t *testing.T) {
+	testutils.RunWithTempDir("TestCompaction_Leveled", func(dir string) {
+		options := []ConfigOption{WithDatadir(dir), WithFlushThreshold(1000), WithCompactionStrategy(LeveledCompaction(2, 4096, 1024))}
+		mt, err := CreateMemtable[int, int]("testmt", options...)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		for round := 0; round < 10; round++ {
+			for i := 0; i < 100; i++ {
+				mt.Set(context.Background(), (i*7+round)%300, round)
+			}
+			mt.compact()
+		}
+		for i := 0; i < 10; i++ {
+			mt.Delete(context.Background(), i)
+		}
+		for i := 300; i < 400; i++ {
+			mt.Set(context.Background(), i, i)
+		}
+		mt.compact()
+		testutils.AssertNoError(t, mt.compactTables(), "Fehler beim kompaktieren")
+		tables := mt.snapshotTables()
+		level0 := slices.DeleteFunc(slices.Clone(tables), func(table *lsmTable[int]) bool { return table.meta.level > 0 })
+		testutils.Assert(t, len(level0) < 2 && slices.ContainsFunc(tables, func(table *lsmTable[int]) bool { return table.meta.level == 2 }), "tables have not been compacted")
+		assertLevels(t, tables)
+
+		expected := make(map[int]int)
+		for key, value := range mt.All() {
+			expected[key] = value
+		}
+		for i := 0; i < 10; i++ {
+			_, found := mt.Get(i)
+			testutils.Assert(t, !found, "deleted key %d has been found", i)
+		}
+		testutils.Assert(t, len(expected) == 390, "expected 390 entries, but got %d", len(expected))
+		mt.Close()
+
+		reopend, err := CreateMemtable[int, int]("testmt", options...)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		testutils.Assert(t, reopend.Size() == 390, "expected 390 entries, but got %d", reopend.Size())
+		for key, value := range expected {
+			actual, _ := reopend.Get(key)
+			testutils.Assert(t, actual == value, "expected %d for key %d, but got %d", value, key, actual)
+		}
+		reopend.Close()
+	})
+}
+
+func TestCompaction_SizeTiered(t *testing.T) {
+	testutils.RunWithTempDir("TestCompaction_SizeTiered", func(dir string) {
+		mt, err := CreateMemtable[int, int]("testmt", WithDatadir(dir), WithFlushThreshold(1000), WithCompactionStrategy(SizeTieredCompaction(4)))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		for round := 0; round < 4; round++ {
+			for i := 0; i < 20; i++ {
+				mt.Set(context.Background(), i, round)
+			}
+			mt.Delete(context.Background(), 20+round)
+			mt.compact()
+		}
+		testutils.AssertNoError(t, mt.compactTables(), "Fehler beim kompaktieren")
+		tables := mt.snapshotTables()
+		testutils.Assert(t, len(tables) == 1 && tables[0].meta.level == 0, "expected 1 table, but got %d", len(tables))
+		// the oldest table has been merged, so no deletes are kept
+		testutils.Assert(t, tables[0].Len() == 20, "expected 20 entries, but got %d", tables[0].Len())
+		value, _ := mt.Get(10)
+		testutils.Assert(t, value == 3, "expected 3, but got %d", value)
+
+		// the merged table is larger than the new ones
+		for round := 0; round < 3; round++ {
+			mt.Set(context.Background(), round, 10)
+			mt.compact()
+		}
+		testutils.AssertNoError(t, mt.compactTables(), "Fehler beim kompaktieren")
+		testutils.Assert(t, len(mt.snapshotTables()) == 4, "expected 4 tables, but got %d", len(mt.snapshotTables()))
+		value, _ = mt.Get(1)
+		testutils.Assert(t, value == 10 && mt.Size() == 20, "unexpected memtable after flush")
+		mt.Close()
+	})
+}
+
+func TestCompaction_Recovery(t *testing.T) {
+	testutils.RunWithTempDir("TestCompaction_Recovery", func(dir string) {
+		options := []ConfigOption{WithDatadir(dir), WithFlushThreshold(1000), WithCompactionStrategy(LeveledCompaction(10, 1<<20, 256))}
+		mt, err := CreateMemtable[int, string]("testmt", options...)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		for round := 0; round < 2; round++ {
+			for i := 0; i < 50; i++ {
+				mt.Set(context.Background(), i, fmt.Sprintf("value-%d-%d", i, round))
+			}
+			mt.compact()
+		}
+		mt.Set(context.Background(), 0, "latest")
+		mt.compact()
+		inputs := make(map[string][]byte)
+		for _, table := range mt.snapshotTables() {
+			inputs[table.Filename()], _ = os.ReadFile(table.Filename())
+		}
+		manifestFile := mt.manifest.filename
+		manifestContent, _ := os.ReadFile(manifestFile)
+		mt.compactionMutex.Lock()
+		mt.compaction = LeveledCompaction(3, 1<<20, 256)
+		mt.compactionMutex.Unlock()
+		testutils.AssertNoError(t, mt.compactTables(), "Fehler beim kompaktieren")
+		outputs := mt.snapshotTables()
+		testutils.Assert(t, len(outputs) > 1, "expected multiple tables, but got %d", len(outputs))
+		mt.Close()
+
+		assertContent := func(count int) {
+			reopend, err := CreateMemtable[int, string]("testmt", options...)
+			testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+			tables := reopend.snapshotTables()
+			testutils.Assert(t, len(tables) == count, "expected %d tables, but got %d", count, len(tables))
+			value, _ := reopend.Get(0)
+			testutils.Assert(t, value == "latest", "expected latest, but got %s", value)
+			value, _ = reopend.Get(49)
+			testutils.Assert(t, value == "value-49-1" && reopend.Size() == 50, "unexpected memtable after recovery")
+			reopend.Close()
+		}
+
+		// the merged tables are removed if the compaction is interrupted after the manifest has been written
+		for filename, content := range inputs {
+			os.WriteFile(filename, content, 0644)
+		}
+		assertContent(len(outputs))
+		for filename := range inputs {
+			_, err := os.Stat(filename)
+			testutils.Assert(t, os.IsNotExist(err), "merged table %s has not been removed", filename)
+		}
+
+		// the written tables are removed if the compaction is interrupted before the manifest has been written
+		for filename, content := range inputs {
+			os.WriteFile(filename, content, 0644)
+		}
+		os.WriteFile(manifestFile, manifestContent, 0644)
+		assertContent(len(inputs))
+		for _, output := range outputs {
+			if _, found := inputs[output.Filename()]; !found {
+				_, err := os.Stat(output.Filename())
+				testutils.Assert(t, os.IsNotExist(err), "written table %s has not been removed", output.Filename())
+			}
+		}
+	})
+}
@@ -0,0 +1,62 @@
+package memtable
+
+import (
+	"bytes"
+	"context"
+)
+
+// SetIfAbsent writes the key value pair only if key does not exist yet and returns true if it was written
+func (mt *Memtable[K, V]) SetIfAbsent(ctx context.Context, key K, value V) (bool, error) {
+	var written bool
+	err := mt.write(ctx, func() ([]mutation[K, V], error) {
+		if _, found, err := mt.lookupLocked(key); err != nil || found {
+			return nil, err
+		}
+		written = true
+		return []mutation[K, V]{{Type: write, Key: key, Value: value}}, nil
+	})
+	return written && err == nil, err
+}
+
+// CompareAndSwap replaces the value of key with value only if the current value equals expected and returns
+// true if it was replaced. Values are compared by their encoded representation of the configured codec.
+func (mt *Memtable[K, V]) CompareAndSwap(ctx context.Context, key K, expected V, value V) (bool, error) {
+	var swapped bool
+	err := mt.write(ctx, func() ([]mutation[K, V], error) {
+		if equal, err := mt.currentEqualsLocked(key, expected); err != nil || !equal {
+			return nil, err
+		}
+		swapped = true
+		return []mutation[K, V]{{Type: write, Key: key, Value: value}}, nil
+	})
+	return swapped && err == nil, err
+}
+
+// DeleteIf removes key only if predicate returns true for the current value and returns true if it was removed
+func (mt *Memtable[K, V]) DeleteIf(ctx context.Context, key K, predicate func(V) bool) (bool, error) {
+	var deleted bool
+	err := mt.write(ctx, func() ([]mutation[K, V], error) {
+		if rec, found, err := mt.lookupLocked(key); err != nil || !found || !predicate(rec.value) {
+			return nil, err
+		}
+		deleted = true
+		return []mutation[K, V]{{Type: delete, Key: key}}, nil
+	})
+	return deleted && err == nil, err
+}
+
+// currentEqualsLocked compares the encoded current value of key with the encoded expected value.
+// The caller must hold mt.mutex.
+func (mt *Memtable[K, V]) currentEqualsLocked(key K, expected V) (bool, error) {
+	rec, found, err := mt.lookupLocked(key)
+	if err != nil || !found {
+		return false, err
+	}
+	if current, err := mt.codec.Encode(rec.value); err != nil {
+		return false, err
+	} else if wanted, err := mt.codec.Encode(expected); err != nil {
+		return false, err
+	} else {
+		return bytes.Equal(current, wanted), nil
+	}
+}
@@ -0,0 +1,67 @@
+package memtable
+
+import (
+	"context"
+	"github.com/mwildt/goodb/utils/testutils"
+	"sync"
+	"testing"
+)
+
+type account struct {
+	Owner   string
+	Balance int
+}
+
+func TestConditionalWrites(t *testing.T) {
+	testutils.RunWithTempDir("TestConditionalWrites", func(dir string) {
+		mt, err := CreateMemtable[int, account]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+
+		written, err := mt.SetIfAbsent(context.Background(), 1, account{"anna", 10})
+		testutils.Assert(t, written && err == nil, "SetIfAbsent did not write absent key")
+		written, _ = mt.SetIfAbsent(context.Background(), 1, account{"bert", 20})
+		testutils.Assert(t, !written, "SetIfAbsent overwrote existing key")
+
+		swapped, _ := mt.CompareAndSwap(context.Background(), 1, account{"anna", 99}, account{"anna", 0})
+		testutils.Assert(t, !swapped, "CompareAndSwap swapped unexpected value")
+		swapped, _ = mt.CompareAndSwap(context.Background(), 1, account{"anna", 10}, account{"anna", 15})
+		testutils.Assert(t, swapped, "CompareAndSwap did not swap expected value")
+		swapped, _ = mt.CompareAndSwap(context.Background(), 2, account{}, account{"carl", 1})
+		testutils.Assert(t, !swapped, "CompareAndSwap swapped absent key")
+
+		deleted, _ := mt.DeleteIf(context.Background(), 1, func(a account) bool { return a.Balance > 100 })
+		testutils.Assert(t, !deleted, "DeleteIf deleted although predicate was false")
+		deleted, _ = mt.DeleteIf(context.Background(), 1, func(a account) bool { return a.Balance == 15 })
+		testutils.Assert(t, deleted, "DeleteIf did not delete")
+		testutils.Assert(t, mt.Size() == 0, "expected empty memtable, but size is %d", mt.Size())
+		mt.Close()
+	})
+}
+
+func TestCompareAndSwap_Concurrent(t *testing.T) {
+	testutils.RunWithTempDir("TestCompareAndSwap_Concurrent", func(dir string) {
+		mt, err := CreateMemtable[string, int]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), "counter", 0)
+
+		wg := sync.WaitGroup{}
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 25; i++ {
+					for {
+						current, _ := mt.Get("counter")
+						if swapped, _ := mt.CompareAndSwap(context.Background(), "counter", current, current+1); swapped {
+							break
+						}
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		value, _ := mt.Get("counter")
+		testutils.Assert(t, value == 200, "expected counter 200, but got %d", value)
+		mt.Close()
+	})
+}
@@ -1,5 +1,13 @@
 package memtable
 
+import (
+	"cmp"
+	"github.com/mwildt/goodb/codecs"
+	"github.com/mwildt/goodb/messagelog"
+	"golang.org/x/exp/constraints"
+	"time"
+)
+
 type MigrationObject map[string]interface{}
 
 type memtableConfiguration struct {
@@ -8,6 +16,20 @@ type memtableConfiguration struct {
 	compactThreshold  int
 	enableAutoCompact bool
 	migrations        []Migration[MigrationObject]
+	defaultTTL        time.Duration
+	reaperInterval    time.Duration
+	indexes           []indexDefinition
+	recoverLog        bool
+	syncPolicy        *messagelog.SyncPolicy
+	segmentSize       int64
+	segmentRecords    int
+	recordFormat      codecs.Format // nil selects the format of an existing log or the default format
+	valueCodec        any           // codecs.Codec of the memtable's value type
+	keyRing           *codecs.KeyRing
+	registry          *codecs.Registry
+	flushThreshold    int
+	compaction        CompactionStrategy
+	bloomRate         float64
 }
 
 type ConfigOption func(*memtableConfiguration)
@@ -19,6 +41,9 @@ func newConfig(options []ConfigOption) memtableConfiguration {
 		compactThreshold:  100,
 		enableAutoCompact: true,
 		migrations:        make([]Migration[MigrationObject], 0),
+		reaperInterval:    time.Minute,
+		compaction:        LeveledCompaction(4, 8<<20, 2<<20),
+		bloomRate:         0.01,
 	}
 	for _, opt := range options {
 		opt(&config)
@@ -26,6 +51,50 @@ func newConfig(options []ConfigOption) memtableConfiguration {
 	return config
 }
 
+// logOptions returns the options for the message logs of the memtable
+func (c memtableConfiguration) logOptions() []messagelog.Option {
+	options := make([]messagelog.Option, 0)
+	if c.recoverLog {
+		options = append(options, messagelog.WithRecovery())
+	}
+	if c.syncPolicy != nil {
+		options = append(options, messagelog.WithSyncPolicy(*c.syncPolicy))
+	}
+	if c.segmentSize > 0 {
+		options = append(options, messagelog.WithSegmentSize(c.segmentSize))
+	}
+	if c.segmentRecords > 0 {
+		options = append(options, messagelog.WithSegmentRecords(c.segmentRecords))
+	}
+	return options
+}
+
+// logFormat returns the record format of new logs
+func (c memtableConfiguration) logFormat() codecs.Format {
+	format := cmp.Or(c.recordFormat, defaultRecordFormat())
+	if c.keyRing != nil {
+		return codecs.EncryptionFormat(format, c.keyRing)
+	}
+	return format
+}
+
+// codecRegistry returns the registry which selects the codecs of an existing log. With encryption it resolves
+// encrypted formats with the configured keys.
+func (c memtableConfiguration) codecRegistry() *codecs.Registry {
+	registry := cmp.Or(c.registry, codecs.DefaultRegistry)
+	if c.keyRing != nil {
+		registry = registry.Clone()
+		registry.RegisterWrapper(encryptionWrapper, func(delegate codecs.Format) codecs.Format {
+			return codecs.EncryptionFormat(delegate, c.keyRing)
+		})
+	}
+	return registry
+}
+
+func (c memtableConfiguration) segmented() bool {
+	return c.segmentSize > 0 || c.segmentRecords > 0
+}
+
 func WithMigration(name, version string, handler func(MigrationObject) (MigrationObject, error)) ConfigOption {
 	return func(c *memtableConfiguration) {
 		c.migrations = append(c.migrations, Migration[MigrationObject]{name, version, handler})
@@ -49,3 +118,129 @@ func WithDisableAutoCompaction() ConfigOption {
 		c.enableAutoCompact = false
 	}
 }
+
+// WithDefaultTTL sets the time-to-live of all writes which do not specify one
+func WithDefaultTTL(ttl time.Duration) ConfigOption {
+	return func(c *memtableConfiguration) {
+		c.defaultTTL = ttl
+	}
+}
+
+// WithReaperInterval sets the interval in which expired keys are removed from the index
+func WithReaperInterval(interval time.Duration) ConfigOption {
+	return func(c *memtableConfiguration) {
+		c.reaperInterval = interval
+	}
+}
+
+// WithIndex adds a secondary index on the keys returned by extractor for each value. Only the primary key
+// type has to be given explicitly, e.g. WithIndex[int]("byName", func(p Person) []string { return []string{p.Name} })
+func WithIndex[K constraints.Ordered, V any, IK constraints.Ordered](name string, extractor func(V) []IK) ConfigOption {
+	return withSecondaryIndex[K](name, extractor, false)
+}
+
+// WithUniqueIndex adds a secondary index like WithIndex, writes which would assign an index key to a second
+// primary key are rejected with ErrUniqueConstraint
+func WithUniqueIndex[K constraints.Ordered, V any, IK constraints.Ordered](name string, extractor func(V) []IK) ConfigOption {
+	return withSecondaryIndex[K](name, extractor, true)
+}
+
+func withSecondaryIndex[K constraints.Ordered, V any, IK constraints.Ordered](name string, extractor func(V) []IK, unique bool) ConfigOption {
+	return func(c *memtableConfiguration) {
+		c.indexes = append(c.indexes, indexDefinition{name, func() any {
+			return newSkiplistIndex[K](name, extractor, unique)
+		}})
+	}
+}
+
+// WithLogRecovery truncates a log with a truncated or corrupt tail after the last valid record on open,
+// instead of failing to create the memtable
+func WithLogRecovery() ConfigOption {
+	return func(c *memtableConfiguration) {
+		c.recoverLog = true
+	}
+}
+
+// WithDurability sets when writes are flushed to stable storage. With messagelog.SyncAlways Set, Delete and
+// all other writes return after their record has been synced.
+func WithDurability(policy messagelog.SyncPolicy) ConfigOption {
+	return func(c *memtableConfiguration) {
+		c.syncPolicy = &policy
+	}
+}
+
+// WithSegmentSize splits the log into segments of about size bytes. Compaction then removes old segments, which
+// no longer contain live records, instead of rewriting the log, and runs after the log rolled to a new segment.
+func WithSegmentSize(size int64) ConfigOption {
+	return func(c *memtableConfiguration) {
+		c.segmentSize = size
+	}
+}
+
+// WithSegmentRecords splits the log into segments of records records like WithSegmentSize
+func WithSegmentRecords(records int) ConfigOption {
+	return func(c *memtableConfiguration) {
+		c.segmentRecords = records
+	}
+}
+
+// WithFlushThreshold stores the data in a log-structured merge tree: when the in-memory index holds records
+// records, including deletes, it is flushed to a sorted table file on disk and the log is truncated. Reads search
+// the index and then the tables from the newest to the oldest. The tables are merged in the background, see
+// WithCompactionStrategy.
+func WithFlushThreshold(records int) ConfigOption {
+	return func(c *memtableConfiguration) {
+		c.flushThreshold = records
+	}
+}
+
+// WithCompactionStrategy selects how the tables written by WithFlushThreshold are merged in the background. The
+// default is LeveledCompaction(4, 8<<20, 2<<20).
+func WithCompactionStrategy(strategy CompactionStrategy) ConfigOption {
+	return func(c *memtableConfiguration) {
+		c.compaction = strategy
+	}
+}
+
+// WithBloomFilter sets the false positive rate of the bloom filters of the tables written by WithFlushThreshold,
+// the default is 0.01. A lookup skips the tables whose filter rejects the key, a rate of 0 writes no filters.
+func WithBloomFilter(falsePositiveRate float64) ConfigOption {
+	return func(c *memtableConfiguration) {
+		c.bloomRate = falsePositiveRate
+	}
+}
+
+// WithCodec sets the format of the log records. The format and the value codec are recorded in the header of the
+// log, opening a log written with other codecs fails with messagelog.ErrCodecMismatch. Without this option an
+// existing log is read in the format named in its header and new logs, including compacted ones, are written with
+// codecs.BinaryFormat.
+func WithCodec(format codecs.Format) ConfigOption {
+	return func(c *memtableConfiguration) {
+		c.recordFormat = format
+	}
+}
+
+// WithValueCodec sets the codec of the values inside the log records. Without this option the value codec named in
+// the header of an existing log is used, the default is JSON. Migrations decode values as JSON, so they require a
+// JSON compatible value codec.
+func WithValueCodec[V any](codec codecs.Codec[V]) ConfigOption {
+	return func(c *memtableConfiguration) {
+		c.valueCodec = codec
+	}
+}
+
+// WithEncryption encrypts the log records with AES-GCM and the current key of keys. Logs written before are
+// rewritten encrypted when the memtable is created, logs of rotated keys stay readable as long as keys contains them.
+func WithEncryption(keys *codecs.KeyRing) ConfigOption {
+	return func(c *memtableConfiguration) {
+		c.keyRing = keys
+	}
+}
+
+// WithCodecRegistry sets the registry which resolves the codecs named in the header of an existing log, the
+// default is codecs.DefaultRegistry
+func WithCodecRegistry(registry *codecs.Registry) ConfigOption {
+	return func(c *memtableConfiguration) {
+		c.registry = registry
+	}
+}
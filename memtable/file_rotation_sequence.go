@@ -18,10 +18,12 @@ type fileRotationSequence struct {
 }
 
 func (seq *fileRotationSequence) CurrentFilename() string {
-	return path.Join(
-		seq.basedir,
-		fmt.Sprintf("%s.%d.%s", seq.basename, seq.currentIndex, seq.suffix),
-	)
+	return seq.Filename(seq.currentIndex)
+}
+
+// Filename returns the name of the nth file of the sequence
+func (seq *fileRotationSequence) Filename(n int) string {
+	return path.Join(seq.basedir, fmt.Sprintf("%s.%d.%s", seq.basename, n, seq.suffix))
 }
 
 func (seq *fileRotationSequence) NextFilename() string {
@@ -37,7 +39,8 @@ func (seq *fileRotationSequence) Increase() int {
 }
 
 func initFileRotationSequence(basedir string, basename string, suffix string) (seq *fileRotationSequence, err error) {
-	pattern := regexp.MustCompile(fmt.Sprintf(`^%s\.(\d+)\.%s$`, basename, suffix))
+	// segments of a segmented log are suffixed with the offset of their first record
+	pattern := regexp.MustCompile(fmt.Sprintf(`^%s\.(\d+)\.%s(\.\d+)?$`, basename, suffix))
 
 	files, err := os.ReadDir(basedir)
 	if err != nil {
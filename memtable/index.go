@@ -0,0 +1,228 @@
+package memtable
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mwildt/goodb/base"
+	"github.com/mwildt/goodb/skiplist"
+	"golang.org/x/exp/constraints"
+	"maps"
+	"slices"
+)
+
+var (
+	// ErrUniqueConstraint is returned if a write would assign an index key of a unique index to a second key
+	ErrUniqueConstraint = errors.New("unique constraint violation")
+	// ErrUnknownIndex is returned when querying an index which has not been configured
+	ErrUnknownIndex = errors.New("unknown index")
+	// ErrIndexKeyType is returned when querying an index with a key of the wrong type
+	ErrIndexKeyType = errors.New("wrong index key type")
+)
+
+// secondaryIndex is the part of an index which does not depend on the type of the index keys
+type secondaryIndex[K constraints.Ordered, V any] interface {
+	name() string
+	insert(key K, value V)
+	remove(key K, value V)
+	// validate checks the unique constraint for the mutations applied in order. exists reports if a key
+	// currently has a visible value.
+	validate(mutations []mutation[K, V], exists func(K) (bool, error)) error
+	lookup(indexKey any) ([]K, error)
+	lookupRange(from, to any, opts base.RangeOptions) ([]K, error)
+}
+
+// indexDefinition is collected by WithIndex, build creates a new secondaryIndex for each memtable
+type indexDefinition struct {
+	name  string
+	build func() any
+}
+
+// skiplistIndex maps each index key to the sorted primary keys of the values it has been extracted from. The
+// slices of primary keys are replaced on modification, so readers never see partial updates.
+type skiplistIndex[K constraints.Ordered, V any, IK constraints.Ordered] struct {
+	indexName string
+	extractor func(V) []IK
+	unique    bool
+	entries   *skiplist.ConcurrentSkipList[IK, []K]
+}
+
+func newSkiplistIndex[K constraints.Ordered, V any, IK constraints.Ordered](name string, extractor func(V) []IK, unique bool) *skiplistIndex[K, V, IK] {
+	return &skiplistIndex[K, V, IK]{
+		indexName: name,
+		extractor: extractor,
+		unique:    unique,
+		entries:   skiplist.NewConcurrentSkipList[IK, []K](),
+	}
+}
+
+func (idx *skiplistIndex[K, V, IK]) name() string {
+	return idx.indexName
+}
+
+func (idx *skiplistIndex[K, V, IK]) insert(key K, value V) {
+	for _, indexKey := range idx.extractor(value) {
+		keys, _ := idx.entries.Get(indexKey)
+		if pos, found := slices.BinarySearch(keys, key); !found {
+			idx.entries.Set(indexKey, slices.Insert(slices.Clone(keys), pos, key))
+		}
+	}
+}
+
+func (idx *skiplistIndex[K, V, IK]) remove(key K, value V) {
+	for _, indexKey := range idx.extractor(value) {
+		keys, _ := idx.entries.Get(indexKey)
+		if pos, found := slices.BinarySearch(keys, key); !found {
+			continue
+		} else if len(keys) == 1 {
+			idx.entries.Delete(indexKey)
+		} else {
+			idx.entries.Set(indexKey, slices.Delete(slices.Clone(keys), pos, pos+1))
+		}
+	}
+}
+
+func (idx *skiplistIndex[K, V, IK]) validate(mutations []mutation[K, V], exists func(K) (bool, error)) error {
+	if !idx.unique {
+		return nil
+	}
+	claimed := make(map[IK]K)   // index keys assigned by earlier mutations
+	touched := make(map[K]bool) // keys whose stored value has been replaced by earlier mutations
+	for _, m := range mutations {
+		maps.DeleteFunc(claimed, func(_ IK, owner K) bool { return owner == m.Key })
+		touched[m.Key] = true
+		if m.Type != write {
+			continue
+		}
+		for _, indexKey := range idx.extractor(m.Value) {
+			if owner, found := claimed[indexKey]; found && owner != m.Key {
+				return idx.violation(indexKey)
+			}
+			owners, _ := idx.entries.Get(indexKey)
+			for _, owner := range owners {
+				if owner == m.Key || touched[owner] {
+					continue
+				} else if found, err := exists(owner); err != nil {
+					return err
+				} else if found {
+					return idx.violation(indexKey)
+				}
+			}
+			claimed[indexKey] = m.Key
+		}
+	}
+	return nil
+}
+
+func (idx *skiplistIndex[K, V, IK]) violation(indexKey IK) error {
+	return fmt.Errorf("%w: index %s already contains %v", ErrUniqueConstraint, idx.indexName, indexKey)
+}
+
+func (idx *skiplistIndex[K, V, IK]) lookup(indexKey any) ([]K, error) {
+	if ik, ok := indexKey.(IK); !ok {
+		return nil, idx.keyTypeError(indexKey)
+	} else {
+		keys, _ := idx.entries.Get(ik)
+		return keys, nil
+	}
+}
+
+func (idx *skiplistIndex[K, V, IK]) lookupRange(from, to any, opts base.RangeOptions) (keys []K, err error) {
+	lower, ok := from.(IK)
+	if !ok {
+		return nil, idx.keyTypeError(from)
+	}
+	upper, ok := to.(IK)
+	if !ok {
+		return nil, idx.keyTypeError(to)
+	}
+	// a primary key with several index keys in the range is returned at its first position
+	seen := make(map[K]bool)
+	add := func(key K) {
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	for _, entry := range idx.entries.Range(lower, upper, opts) {
+		if opts.Reverse {
+			for _, key := range slices.Backward(entry.Value) {
+				add(key)
+			}
+		} else {
+			for _, key := range entry.Value {
+				add(key)
+			}
+		}
+	}
+	return keys, nil
+}
+
+func (idx *skiplistIndex[K, V, IK]) keyTypeError(indexKey any) error {
+	var expected IK
+	return fmt.Errorf("%w: index %s expects %T, but got %T", ErrIndexKeyType, idx.indexName, expected, indexKey)
+}
+
+// buildIndexes creates the configured secondary indexes for a memtable of the given key and value type
+func buildIndexes[K constraints.Ordered, V any](definitions []indexDefinition) ([]secondaryIndex[K, V], error) {
+	indexes := make([]secondaryIndex[K, V], 0, len(definitions))
+	for _, definition := range definitions {
+		if idx, ok := definition.build().(secondaryIndex[K, V]); !ok {
+			return nil, fmt.Errorf("index %s does not match the key and value type of the memtable", definition.name)
+		} else if slices.ContainsFunc(indexes, func(other secondaryIndex[K, V]) bool { return other.name() == idx.name() }) {
+			return nil, fmt.Errorf("duplicate index %s", definition.name)
+		} else {
+			indexes = append(indexes, idx)
+		}
+	}
+	return indexes, nil
+}
+
+func (mt *Memtable[K, V]) secondaryIndex(name string) (secondaryIndex[K, V], error) {
+	for _, idx := range mt.indexes {
+		if idx.name() == name {
+			return idx, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownIndex, name)
+}
+
+// QueryIndex returns all entries whose value contains indexKey in the named index, ordered by primary key
+func (mt *Memtable[K, V]) QueryIndex(name string, indexKey any) ([]base.Entry[K, V], error) {
+	if idx, err := mt.secondaryIndex(name); err != nil {
+		return nil, err
+	} else if keys, err := idx.lookup(indexKey); err != nil {
+		return nil, err
+	} else {
+		return mt.resolve(keys, 0)
+	}
+}
+
+// QueryIndexRange returns all entries with index keys between from and to in the named index. Bounds and order
+// of the index keys are controlled by opts, the limit applies to the number of entries.
+func (mt *Memtable[K, V]) QueryIndexRange(name string, from, to any, opts base.RangeOptions) ([]base.Entry[K, V], error) {
+	limit := opts.Limit
+	opts.Limit = 0
+	if idx, err := mt.secondaryIndex(name); err != nil {
+		return nil, err
+	} else if keys, err := idx.lookupRange(from, to, opts); err != nil {
+		return nil, err
+	} else {
+		return mt.resolve(keys, limit)
+	}
+}
+
+// resolve returns the visible entries of keys, at most limit entries if limit is positive
+func (mt *Memtable[K, V]) resolve(keys []K, limit int) ([]base.Entry[K, V], error) {
+	entries := make([]base.Entry[K, V], 0, len(keys))
+	for _, key := range keys {
+		if limit > 0 && len(entries) == limit {
+			break
+		}
+		if rec, found, err := mt.lookup(key); err != nil {
+			return nil, err
+		} else if found {
+			entries = append(entries, base.Entry[K, V]{Key: key, Value: rec.value})
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,96 @@
+package memtable
+
+import (
+	"context"
+	"errors"
+	"github.com/mwildt/goodb/base"
+	"github.com/mwildt/goodb/utils/testutils"
+	"testing"
+)
+
+type order struct {
+	Customer string
+	Amount   int
+	Tags     []string
+}
+
+func TestQueryIndex(t *testing.T) {
+	testutils.RunWithTempDir("TestQueryIndex", func(dir string) {
+		options := []ConfigOption{
+			WithDatadir(dir),
+			WithIndex[int]("byCustomer", func(o order) []string { return []string{o.Customer} }),
+			WithIndex[int]("byAmount", func(o order) []int { return []int{o.Amount} }),
+			WithIndex[int]("byTag", func(o order) []string { return o.Tags }),
+		}
+		mt, err := CreateMemtable[int, order]("orders", options...)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), 1, order{"anna", 10, []string{"express"}})
+		mt.Set(context.Background(), 2, order{"bert", 20, nil})
+		mt.Set(context.Background(), 3, order{"anna", 30, []string{"express", "gift"}})
+		mt.Set(context.Background(), 4, order{"carl", 40, []string{"gift"}})
+		mt.Set(context.Background(), 2, order{"anna", 25, nil})
+		mt.Delete(context.Background(), 4)
+
+		entries, err := mt.QueryIndex("byCustomer", "anna")
+		testutils.AssertNoError(t, err, "Fehler bei der abfrage")
+		testutils.Assert(t, len(entries) == 3, "expected 3 orders of anna, but got %d", len(entries))
+		entries, _ = mt.QueryIndex("byCustomer", "bert")
+		testutils.Assert(t, len(entries) == 0, "expected no orders of bert, but got %d", len(entries))
+		entries, _ = mt.QueryIndex("byTag", "gift")
+		testutils.Assert(t, len(entries) == 1 && entries[0].Key == 3, "expected order 3 for tag gift, but got %v", entries)
+
+		entries, _ = mt.QueryIndexRange("byAmount", 20, 40, base.RangeOptions{Reverse: true, Limit: 2})
+		testutils.Assert(t, len(entries) == 2, "expected 2 entries, but got %d", len(entries))
+		testutils.Assert(t, entries[0].Value.Amount == 30 && entries[1].Value.Amount == 25, "wrong order %v", entries)
+		entries, _ = mt.QueryIndexRange("byTag", "a", "z", base.RangeOptions{})
+		testutils.Assert(t, len(entries) == 2 && entries[0].Key == 1 && entries[1].Key == 3, "expected orders 1 and 3 once, but got %v", entries)
+
+		_, err = mt.QueryIndex("byAmount", "zehn")
+		testutils.Assert(t, errors.Is(err, ErrIndexKeyType), "expected ErrIndexKeyType, but got %v", err)
+		_, err = mt.QueryIndex("unknown", "x")
+		testutils.Assert(t, errors.Is(err, ErrUnknownIndex), "expected ErrUnknownIndex, but got %v", err)
+		mt.Close()
+
+		reopend, err := CreateMemtable[int, order]("orders", options...)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		entries, _ = reopend.QueryIndex("byCustomer", "anna")
+		testutils.Assert(t, len(entries) == 3, "expected 3 orders of anna after replay, but got %d", len(entries))
+		reopend.Close()
+	})
+}
+
+func TestUniqueIndex(t *testing.T) {
+	testutils.RunWithTempDir("TestUniqueIndex", func(dir string) {
+		mt, err := CreateMemtable[int, string]("users", WithDatadir(dir),
+			WithUniqueIndex[int]("byName", func(name string) []string { return []string{name} }))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+
+		_, err = mt.Set(context.Background(), 1, "anna")
+		testutils.AssertNoError(t, err, "Fehler beim schreiben")
+		_, err = mt.Set(context.Background(), 1, "anna")
+		testutils.AssertNoError(t, err, "rewrite of the same key rejected")
+		_, err = mt.Set(context.Background(), 2, "anna")
+		testutils.Assert(t, errors.Is(err, ErrUniqueConstraint), "expected ErrUniqueConstraint, but got %v", err)
+		_, found := mt.Get(2)
+		testutils.Assert(t, !found, "rejected write is visible")
+		testutils.Assert(t, mt.log.MessageCount() == 2, "rejected write has been logged")
+
+		err = mt.Apply(context.Background(), NewWriteBatch[int, string]().Put(1, "bert").Put(2, "anna"))
+		testutils.AssertNoError(t, err, "moving the name within a batch rejected")
+		err = mt.Apply(context.Background(), NewWriteBatch[int, string]().Put(3, "carl").Put(4, "carl"))
+		testutils.Assert(t, errors.Is(err, ErrUniqueConstraint), "expected ErrUniqueConstraint in batch, but got %v", err)
+
+		mt.Delete(context.Background(), 2)
+		_, err = mt.Set(context.Background(), 5, "anna")
+		testutils.AssertNoError(t, err, "name of deleted key rejected")
+		mt.Close()
+	})
+}
+
+func TestIndexTypeMismatch(t *testing.T) {
+	testutils.RunWithTempDir("TestIndexTypeMismatch", func(dir string) {
+		_, err := CreateMemtable[string, string]("users", WithDatadir(dir),
+			WithIndex[int]("byName", func(name string) []string { return []string{name} }))
+		testutils.Assert(t, err != nil, "expected error for index with wrong key type")
+	})
+}
@@ -0,0 +1,344 @@
+package memtable
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"github.com/mwildt/goodb/base"
+	"github.com/mwildt/goodb/codecs"
+	"github.com/mwildt/goodb/messagelog"
+	"github.com/mwildt/goodb/sstable"
+	"golang.org/x/exp/constraints"
+	"iter"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync/atomic"
+)
+
+// tableMetadata is recorded in each table
+type tableMetadata struct {
+	sequence   uint64 // sequence of the last mutation at the time the table has been written
+	migrations int    // number of migrations applied to the values of the table
+	level      int    // level of the table, flushed tables belong to level 0
+}
+
+func (meta tableMetadata) encode() []byte {
+	data := binary.AppendUvarint(nil, meta.sequence)
+	data = binary.AppendUvarint(data, uint64(meta.migrations))
+	return binary.AppendUvarint(data, uint64(meta.level))
+}
+
+func decodeTableMetadata(data []byte) (meta tableMetadata, err error) {
+	decoder := codecs.NewBinaryDecoder(data)
+	meta.sequence = decoder.Uvarint()
+	meta.migrations = int(decoder.Uvarint())
+	if decoder.Remaining() == 0 {
+		// tables written before compaction has been introduced
+		return meta, decoder.Err()
+	}
+	meta.level = int(decoder.Uvarint())
+	return meta, decoder.Err()
+}
+
+// lsmTable is an open table of a memtable. Readers hold a reference while they use the table, so a table replaced
+// by a compaction is closed when the last reader has released it.
+type lsmTable[K constraints.Ordered] struct {
+	*sstable.Table[K]
+	number int
+	meta   tableMetadata
+	refs   atomic.Int64
+}
+
+func (table *lsmTable[K]) release() {
+	if table.refs.Add(-1) == 0 {
+		table.Close()
+	}
+}
+
+// overlaps reports whether the table contains keys between first and last
+func (table *lsmTable[K]) overlaps(first, last K) bool {
+	tableFirst, found := table.First()
+	tableLast, _ := table.Last()
+	return found && tableFirst <= last && first <= tableLast
+}
+
+// compareTables orders tables for reads: by level and within a level from the newest to the oldest
+func compareTables[K constraints.Ordered](a, b *lsmTable[K]) int {
+	return cmp.Or(cmp.Compare(a.meta.level, b.meta.level), cmp.Compare(b.meta.sequence, a.meta.sequence), cmp.Compare(b.number, a.number))
+}
+
+// tableFilename returns the filename of table number n of the memtable name
+func tableFilename(basedir, name string, n int) string {
+	return path.Join(basedir, fmt.Sprintf("%s.%d.sst", name, n))
+}
+
+// listTables returns the numbers of the tables of the memtable name in ascending order. Temporary files of tables,
+// which have not been completed, are removed.
+func listTables(basedir, name string) ([]int, error) {
+	pattern := regexp.MustCompile(fmt.Sprintf(`^%s\.(\d+)\.sst(\.tmp)?$`, regexp.QuoteMeta(name)))
+	files, err := os.ReadDir(basedir)
+	if err != nil {
+		return nil, err
+	}
+	numbers := make([]int, 0)
+	for _, file := range files {
+		if matches := pattern.FindStringSubmatch(file.Name()); file.IsDir() || matches == nil {
+			continue
+		} else if matches[2] != "" {
+			os.Remove(path.Join(basedir, file.Name()))
+		} else if n, err := strconv.Atoi(matches[1]); err != nil {
+			return nil, err
+		} else {
+			numbers = append(numbers, n)
+		}
+	}
+	slices.Sort(numbers)
+	return numbers, nil
+}
+
+// tableOptions returns the options of the tables of a memtable. Values are stored as log records in the binary
+// format, the blocks are encrypted if encryption is configured. Each table has a bloom filter of its keys.
+func tableOptions[K constraints.Ordered](config memtableConfiguration, valueCodec any) []sstable.Option {
+	blockFormat := codecs.RawFormat()
+	if config.keyRing != nil {
+		blockFormat = codecs.EncryptionFormat(blockFormat, config.keyRing)
+	}
+	return []sstable.Option{
+		sstable.WithCodecName(fmt.Sprintf("%s/%s", codecs.BinaryFormat().Name(), codecs.NameOf(valueCodec))),
+		sstable.WithBlockFormat(blockFormat),
+		sstable.WithCodecRegistry(config.codecRegistry()),
+		sstable.WithBloomFilter(config.bloomRate),
+	}
+}
+
+// openTable opens table number n of the memtable
+func (mt *Memtable[K, V]) openTable(n int) (*lsmTable[K], error) {
+	table, err := sstable.Open[K](tableFilename(mt.frs.basedir, mt.name, n), mt.tableOptions...)
+	if err != nil {
+		return nil, err
+	}
+	meta, err := decodeTableMetadata(table.Metadata())
+	if err != nil {
+		table.Close()
+		return nil, fmt.Errorf("%s: %w", table.Filename(), err)
+	}
+	result := &lsmTable[K]{Table: table, number: n, meta: meta}
+	result.refs.Store(1)
+	return result, nil
+}
+
+// loadTables opens the live tables of the manifest and restores the sequence
+func (mt *Memtable[K, V]) loadTables() (err error) {
+	numbers := mt.manifest.tables(mt.name)
+	if mt.tableFiles, err = initFileRotationSequence(mt.frs.basedir, mt.name, "sst"); err != nil {
+		return err
+	}
+	tables := make([]*lsmTable[K], 0, len(numbers))
+	defer func() {
+		if err != nil {
+			for _, table := range tables {
+				table.Close()
+			}
+		}
+	}()
+	for _, n := range numbers {
+		table, err := mt.openTable(n)
+		if err != nil {
+			return err
+		}
+		tables = append(tables, table)
+		mt.sequence = max(mt.sequence, table.meta.sequence)
+	}
+	mt.replaceTables(nil, tables)
+	return nil
+}
+
+// snapshotTables returns the current tables in read order without acquiring them. Tables are only closed by
+// compactions, so a caller holding mt.compactionMutex may use them.
+func (mt *Memtable[K, V]) snapshotTables() []*lsmTable[K] {
+	mt.tablesMutex.RLock()
+	defer mt.tablesMutex.RUnlock()
+	return mt.tables
+}
+
+// acquireTables returns the current tables in read order and a function which releases them
+func (mt *Memtable[K, V]) acquireTables() ([]*lsmTable[K], func()) {
+	mt.tablesMutex.RLock()
+	defer mt.tablesMutex.RUnlock()
+	tables := mt.tables
+	for _, table := range tables {
+		table.refs.Add(1)
+	}
+	return tables, func() {
+		for _, table := range tables {
+			table.release()
+		}
+	}
+}
+
+// replaceTables replaces the inputs of a compaction with its outputs. The files of the inputs are removed from the
+// oldest to the newest, so an interruption leaves no older version uncovered.
+func (mt *Memtable[K, V]) replaceTables(inputs, outputs []*lsmTable[K]) {
+	mt.tablesMutex.Lock()
+	tables := slices.DeleteFunc(slices.Clone(mt.tables), func(table *lsmTable[K]) bool {
+		return slices.Contains(inputs, table)
+	})
+	tables = append(tables, outputs...)
+	slices.SortFunc(tables, compareTables)
+	mt.tables = tables
+	mt.tablesMutex.Unlock()
+	for _, table := range slices.Backward(inputs) {
+		os.Remove(table.Filename())
+		table.release()
+	}
+}
+
+// encodeRecord encodes a record as the value of a table entry
+func (mt *Memtable[K, V]) encodeRecord(key K, rec record[V]) ([]byte, error) {
+	m := mutation[K, V]{Type: write, Key: key, Value: rec.value, Meta: rec.meta}
+	if rec.tombstone {
+		m.Type = delete
+	}
+	if message, err := mt.encode([]mutation[K, V]{m}); err != nil {
+		return nil, err
+	} else {
+		return message.MarshalBinary()
+	}
+}
+
+// decodeRecord decodes the value of a table entry
+func (mt *Memtable[K, V]) decodeRecord(data []byte) (rec record[V], err error) {
+	message := memtableMessage[K, []byte]{}
+	if err = message.UnmarshalBinary(data); err != nil {
+		return rec, err
+	}
+	mutations, err := mt.decode(message)
+	if err != nil {
+		return rec, err
+	} else if len(mutations) != 1 {
+		return rec, fmt.Errorf("%w: table entry contains %d mutations", codecs.ErrInvalidBinary, len(mutations))
+	}
+	return record[V]{value: mutations[0].Value, meta: mutations[0].Meta, tombstone: mutations[0].Type == delete}, nil
+}
+
+// tableRecords converts the entries of a table to records. A read error is logged and ends the iteration.
+func (mt *Memtable[K, V]) tableRecords(table *lsmTable[K], entries iter.Seq2[base.Entry[K, []byte], error]) iter.Seq2[K, record[V]] {
+	return func(yield func(K, record[V]) bool) {
+		for entry, err := range entries {
+			var rec record[V]
+			if err == nil {
+				rec, err = mt.decodeRecord(entry.Value)
+			}
+			if err != nil {
+				log.Printf("[memtable] reading %s failed: %v\n", table.Filename(), err)
+				return
+			} else if !yield(entry.Key, rec) {
+				return
+			}
+		}
+	}
+}
+
+// records merges the records of the index with the records of the tables. Deleted records are included, so
+// they hide older records.
+func (mt *Memtable[K, V]) records(index iter.Seq2[K, record[V]], entries func(*lsmTable[K]) iter.Seq2[base.Entry[K, []byte], error], reverse bool) iter.Seq2[K, record[V]] {
+	return func(yield func(K, record[V]) bool) {
+		tables, release := mt.acquireTables()
+		defer release()
+		if len(tables) == 0 {
+			index(yield)
+			return
+		}
+		seqs := []iter.Seq2[K, record[V]]{index}
+		for _, table := range tables {
+			seqs = append(seqs, mt.tableRecords(table, entries(table)))
+		}
+		base.Merge(reverse, seqs...)(yield)
+	}
+}
+
+// indexRange returns an iterator over the records with keys between from and to of the index and the tables.
+// Deleted and expired records are included, so the limit of opts is not applied.
+func (mt *Memtable[K, V]) indexRange(from, to K, opts base.RangeOptions) iter.Seq2[K, record[V]] {
+	opts.Limit = 0
+	entries := func(table *lsmTable[K]) iter.Seq2[base.Entry[K, []byte], error] {
+		return table.Range(from, to, opts)
+	}
+	return mt.records(mt.index.RangeSeq(from, to, opts), entries, opts.Reverse)
+}
+
+// flushLocked writes the records of the index to a new table, replaces the log with an empty one and clears the
+// index. The table and the new log replace the old log in a single edit of the manifest. The caller must hold
+// mt.mutex.
+func (mt *Memtable[K, V]) flushLocked() error {
+	mt.settleLocked()
+	if mt.index.Size() == 0 {
+		return nil
+	}
+	n := mt.tableFiles.Increase()
+	filename := tableFilename(mt.frs.basedir, mt.name, n)
+	metadata := tableMetadata{sequence: mt.sequence, migrations: mt.migrations}
+	writer, err := sstable.NewWriter[K](filename, append(slices.Clone(mt.tableOptions), sstable.WithMetadata(metadata.encode()))...)
+	if err != nil {
+		return err
+	}
+	for key, rec := range mt.index.All() {
+		if data, err := mt.encodeRecord(key, rec); err != nil {
+			writer.Abort()
+			return err
+		} else if err := writer.Add(key, data); err != nil {
+			writer.Abort()
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	table, err := mt.openTable(n)
+	if err != nil {
+		return err
+	}
+	mLog, err := messagelog.NewMessageLog[memtableMessage[K, []byte]](mt.frs.NextFilename(), mt.logOptions...)
+	if err == nil {
+		_, err = mLog.Open(messagelog.Noop[memtableMessage[K, []byte]]())
+	}
+	if err == nil {
+		if err = mt.manifest.apply([]string{filename, mLog.GetFilename()}, []string{mt.log.GetFilename()}); err != nil {
+			mLog.Close()
+			mLog.Delete()
+		}
+	}
+	if err != nil {
+		table.Close()
+		os.Remove(filename)
+		return err
+	}
+	mt.replaceTables(nil, []*lsmTable[K]{table})
+	// readers search the index before the tables, so records are removed from the index after the table is visible
+	for key := range mt.index.All() {
+		mt.index.Delete(key)
+	}
+	oldLog := mt.log
+	mt.log = mLog
+	oldLog.Close()
+	oldLog.Delete()
+	log.Printf("[memtable] flushed %d records to %s\n", table.Len(), filename)
+	go mt.compactTables()
+	return nil
+}
+
+// restoreSecondaryIndexes inserts the visible values of the tables into the secondary indexes
+func (mt *Memtable[K, V]) restoreSecondaryIndexes() {
+	if len(mt.indexes) == 0 {
+		return
+	}
+	for key, value := range mt.All() {
+		for _, idx := range mt.indexes {
+			idx.insert(key, value)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package memtable
+
+import (
+	"context"
+	"fmt"
+	"github.com/mwildt/goodb/base"
+	"github.com/mwildt/goodb/utils/testutils"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestFlush(t *testing.T) {
+	testutils.RunWithTempDir("TestFlush", func(dir string) {
+		options := []ConfigOption{WithDatadir(dir), WithFlushThreshold(1000)}
+		mt, err := CreateMemtable[int, int]("testmt", options...)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		for i := 0; i < 20; i++ {
+			mt.Set(context.Background(), i, i)
+		}
+		testutils.AssertNoError(t, mt.compact(), "Fehler beim flush")
+		testutils.Assert(t, len(mt.snapshotTables()) == 1 && mt.index.Size() == 0, "index has not been flushed")
+		testutils.Assert(t, mt.log.MessageCount() == 0, "log has not been truncated")
+
+		// newer writes and deletes hide the records of the table
+		mt.Set(context.Background(), 5, 50)
+		mt.Delete(context.Background(), 6)
+		mt.Set(context.Background(), 100, 100)
+		testutils.AssertNoError(t, mt.compact(), "Fehler beim flush")
+		mt.Delete(context.Background(), 7)
+		mt.Set(context.Background(), 8, 80)
+
+		assertContent := func(mt *Memtable[int, int]) {
+			value, _ := mt.Get(5)
+			testutils.Assert(t, value == 50, "expected 50, but got %d", value)
+			value, _ = mt.Get(8)
+			testutils.Assert(t, value == 80, "expected 80, but got %d", value)
+			value, _ = mt.Get(19)
+			testutils.Assert(t, value == 19, "expected 19, but got %d", value)
+			for _, key := range []int{6, 7, 20} {
+				_, found := mt.Get(key)
+				testutils.Assert(t, !found, "unexpected key %d", key)
+			}
+			testutils.Assert(t, mt.Size() == 19, "expected 19 entries, but got %d", mt.Size())
+
+			keys := slices.Collect(mt.KeysSeq())
+			testutils.Assert(t, len(keys) == 19 && keys[0] == 0 && keys[18] == 100 && slices.IsSorted(keys), "unexpected keys %v", keys)
+			backward := make([]int, 0)
+			for key := range mt.Backward() {
+				backward = append(backward, key)
+			}
+			slices.Reverse(backward)
+			testutils.Assert(t, slices.Equal(keys, backward), "unexpected keys %v", backward)
+
+			entries := mt.Range(4, 9, base.RangeOptions{})
+			testutils.Assert(t, fmt.Sprint(entries) == "[{4 4} {5 50} {8 80} {9 9}]", "unexpected entries %v", entries)
+			entries = mt.Range(4, 9, base.RangeOptions{Reverse: true, Limit: 2, ExcludeTo: true})
+			testutils.Assert(t, fmt.Sprint(entries) == "[{8 80} {5 50}]", "unexpected entries %v", entries)
+			entries = mt.Range(5, 100, base.RangeOptions{Limit: 2})
+			testutils.Assert(t, fmt.Sprint(entries) == "[{5 50} {8 80}]", "unexpected entries %v", entries)
+		}
+		assertContent(mt)
+		mt.Close()
+
+		reopend, err := CreateMemtable[int, int]("testmt", options...)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		testutils.Assert(t, len(reopend.snapshotTables()) == 2, "expected 2 tables, but got %d", len(reopend.snapshotTables()))
+		assertContent(reopend)
+		_, meta, _ := reopend.GetWithMeta(8)
+		reopend.Set(context.Background(), 9, 90)
+		_, newMeta, _ := reopend.GetWithMeta(9)
+		testutils.Assert(t, newMeta.Sequence > meta.Sequence && newMeta.Version == 2, "unexpected metadata %v after %v", newMeta, meta)
+		reopend.Close()
+	})
+}
+
+func TestFlush_Automatic(t *testing.T) {
+	testutils.RunWithTempDir("TestFlush_Automatic", func(dir string) {
+		mt, err := CreateMemtable[string, int]("testmt", WithDatadir(dir), WithFlushThreshold(10), WithIndex[string]("even", func(value int) []int {
+			return []int{value % 2}
+		}))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		for i := 0; i < 100; i++ {
+			mt.Set(context.Background(), fmt.Sprintf("key-%03d", i), i)
+		}
+		for i := 0; i < 100 && len(mt.snapshotTables()) == 0; i++ {
+			time.Sleep(time.Millisecond)
+		}
+		testutils.Assert(t, len(mt.snapshotTables()) > 0, "index has not been flushed")
+		testutils.Assert(t, mt.Size() == 100, "expected 100 entries, but got %d", mt.Size())
+		mt.Close()
+
+		reopend, err := CreateMemtable[string, int]("testmt", WithDatadir(dir), WithFlushThreshold(10), WithIndex[string]("even", func(value int) []int {
+			return []int{value % 2}
+		}))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		reopend.Delete(context.Background(), "key-002")
+		even, err := reopend.QueryIndex("even", 0)
+		testutils.Assert(t, err == nil && len(even) == 49, "expected 49 entries with even values, but got %d (%v)", len(even), err)
+		reopend.Close()
+	})
+}
+
+func TestFlush_TTL(t *testing.T) {
+	testutils.RunWithTempDir("TestFlush_TTL", func(dir string) {
+		mt, err := CreateMemtable[int, string]("testmt", WithDatadir(dir), WithFlushThreshold(1000), WithReaperInterval(5*time.Millisecond))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), 1, "permanent")
+		mt.compact()
+		mt.SetWithTTL(context.Background(), 1, "temporary", 10*time.Millisecond)
+		time.Sleep(30 * time.Millisecond)
+
+		// the reaped record must not uncover the older value of the table
+		_, found := mt.Get(1)
+		testutils.Assert(t, !found, "expired key has been found")
+		mt.compact()
+		_, found = mt.Get(1)
+		testutils.Assert(t, !found && mt.Size() == 0, "expired key has been found after flush")
+		mt.Close()
+	})
+}
+
+func TestFlush_Migration(t *testing.T) {
+	testutils.RunWithTempDir("TestFlush_Migration", func(dir string) {
+		mt, err := CreateMemtable[int, DataV2]("testmt", WithDatadir(dir), WithFlushThreshold(1000))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), 1, DataV2{Name: "eins"})
+		mt.Set(context.Background(), 2, DataV2{Name: "zwei"})
+		mt.compact()
+		mt.Set(context.Background(), 3, DataV2{Name: "drei"})
+		mt.Close()
+
+		migration := WithMigration("length", "V__1", func(obj MigrationObject) (MigrationObject, error) {
+			obj["Length"] = len(obj["Name"].(string))
+			return obj, nil
+		})
+		for run := 0; run < 2; run++ {
+			migrated, err := CreateMemtable[int, DataV2]("testmt", WithDatadir(dir), WithFlushThreshold(1000), migration)
+			testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+			for key, length := range map[int]int{1: 4, 2: 4, 3: 4} {
+				value, _ := migrated.Get(key)
+				testutils.Assert(t, value.Length == length, "key %d has not been migrated: %v", key, value)
+			}
+			testutils.Assert(t, len(migrated.snapshotTables()) == 1, "expected 1 table, but got %d", len(migrated.snapshotTables()))
+			migrated.Close()
+		}
+	})
+}
+
+func TestFlush_BloomFilter(t *testing.T) {
+	testutils.RunWithTempDir("TestFlush_BloomFilter", func(dir string) {
+		for _, rate := range []float64{0.01, 0} {
+			mt, err := CreateMemtable[int, int](fmt.Sprintf("testmt-%v", rate), WithDatadir(dir), WithFlushThreshold(1000), WithBloomFilter(rate))
+			testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+			for i := 0; i < 200; i += 2 {
+				mt.Set(context.Background(), i, i)
+			}
+			mt.compact()
+			table := mt.snapshotTables()[0]
+			candidates := 0
+			for i := 1; i < 200; i += 2 {
+				if table.MayContain(i) {
+					candidates++
+				}
+				_, found := mt.Get(i)
+				testutils.Assert(t, !found, "unexpected key %d", i)
+			}
+			if rate > 0 {
+				testutils.Assert(t, candidates < 10, "expected the filter to reject absent keys, but %d passed", candidates)
+			} else {
+				// only 199 is outside of the key range of the table
+				testutils.Assert(t, candidates == 99, "expected no filter, but %d keys passed", candidates)
+			}
+			mt.Close()
+		}
+	})
+}
+
+func TestFlush_CorruptTable(t *testing.T) {
+	testutils.RunWithTempDir("TestFlush_CorruptTable", func(dir string) {
+		mt, err := CreateMemtable[int, int]("testmt", WithDatadir(dir), WithFlushThreshold(1000))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		for i := 0; i < 20; i++ {
+			mt.Set(context.Background(), i, i)
+		}
+		testutils.AssertNoError(t, mt.compact(), "Fehler beim flush")
+
+		// a damaged data block fails the reads of the writes instead of reporting the keys as absent
+		file, _ := os.OpenFile(mt.snapshotTables()[0].Filename(), os.O_RDWR, 0644)
+		data := make([]byte, 1)
+		file.ReadAt(data, 64)
+		file.WriteAt([]byte{data[0] ^ 0xff}, 64)
+		file.Close()
+
+		written, err := mt.SetIfAbsent(context.Background(), 1, 10)
+		testutils.Assert(t, err != nil && !written, "expected read error, but got %v", err)
+		_, err = mt.CompareAndSwap(context.Background(), 1, 1, 10)
+		testutils.Assert(t, err != nil, "expected read error, but got %v", err)
+		_, err = mt.DeleteIf(context.Background(), 1, func(int) bool { return true })
+		testutils.Assert(t, err != nil, "expected read error, but got %v", err)
+		_, err = mt.Set(context.Background(), 1, 10)
+		testutils.Assert(t, err != nil, "expected read error, but got %v", err)
+		txn := mt.Begin()
+		_, _, err = txn.Get(1)
+		testutils.Assert(t, err != nil, "expected read error, but got %v", err)
+		testutils.Assert(t, mt.log.MessageCount() == 0, "failed writes have been logged")
+		mt.Close()
+	})
+}
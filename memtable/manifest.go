@@ -0,0 +1,238 @@
+package memtable
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/mwildt/goodb/internal/fsutil"
+	"github.com/mwildt/goodb/messagelog"
+	"log"
+	"maps"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// manifestEdit is a record of the manifest. It adds and removes files of a memtable in one step.
+type manifestEdit struct {
+	Added   []string
+	Removed []string
+}
+
+// manifest records the live files of a memtable, its log and its tables. It is an append-only log of edits, which
+// are synced before the files they remove are deleted. A file becomes live with the edit adding it, so files of
+// an interrupted compaction, flush or migration are not live and are removed as orphans when the memtable is
+// opened.
+type manifest struct {
+	filename     string
+	log          *messagelog.MessageLog[manifestEdit]
+	files        map[string]bool // names of the live files relative to the data directory
+	edits        int             // number of records of the manifest log
+	bootstrapped bool            // the manifest has been created from the files of the directory
+	mutex        *sync.Mutex
+}
+
+// manifestRewriteThreshold is the number of edits exceeding the number of live files at which the manifest is
+// rewritten with a single edit
+const manifestRewriteThreshold = 100
+
+var manifestLogOptions = []messagelog.Option{messagelog.WithRecovery(), messagelog.WithSyncPolicy(messagelog.SyncAlways())}
+
+// openManifest opens the manifest of the memtable of frs and replays it. A missing manifest is created from the
+// files of the directory: the newest intact log, see bootstrapLog, and all tables. Orphaned files are removed and
+// frs continues with the number of the live log.
+func openManifest(frs *fileRotationSequence) (*manifest, error) {
+	m := &manifest{
+		filename: path.Join(frs.basedir, fmt.Sprintf("%s.manifest", frs.basename)),
+		files:    make(map[string]bool),
+		mutex:    &sync.Mutex{},
+	}
+	// a rewrite has been interrupted before the new manifest replaced the old one
+	os.Remove(m.filename + ".tmp")
+	if err := m.open(); err != nil {
+		return nil, err
+	}
+	if m.edits == 0 {
+		numbers, err := listTables(frs.basedir, frs.basename)
+		if err != nil {
+			m.close()
+			return nil, err
+		}
+		added := []string{bootstrapLog(frs)}
+		for _, n := range numbers {
+			added = append(added, tableFilename(frs.basedir, frs.basename, n))
+		}
+		if err = m.apply(added, nil); err != nil {
+			m.close()
+			return nil, err
+		}
+		m.bootstrapped = true
+	}
+	if err := m.collectGarbage(frs); err != nil {
+		m.close()
+		return nil, err
+	}
+	return m, nil
+}
+
+// bootstrapLog returns the log with the highest number, unless it is damaged and an older log exists. A damaged
+// log may have been written by an interrupted compaction, which had not removed the log it replaces yet.
+func bootstrapLog(frs *fileRotationSequence) string {
+	for n := frs.currentIndex; n >= 0; n-- {
+		filename := frs.Filename(n)
+		if err := messagelog.Verify(filename); errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err == nil {
+			return filename
+		} else {
+			log.Printf("[memtable] skipping damaged log %s: %v\n", filename, err)
+		}
+	}
+	return frs.CurrentFilename()
+}
+
+func (m *manifest) open() (err error) {
+	if m.log, err = messagelog.NewMessageLog[manifestEdit](m.filename, manifestLogOptions...); err != nil {
+		return err
+	}
+	m.edits, err = m.log.Open(func(_ context.Context, edit manifestEdit) error {
+		m.replay(edit)
+		return nil
+	})
+	if err != nil {
+		m.log.Close()
+	}
+	return err
+}
+
+func (m *manifest) replay(edit manifestEdit) {
+	maps.DeleteFunc(m.files, func(name string, _ bool) bool {
+		return slices.Contains(edit.Removed, name)
+	})
+	for _, name := range edit.Added {
+		m.files[name] = true
+	}
+}
+
+// apply records that the files added have become live and the files removed are not live anymore. The files are
+// given as paths, the caller deletes the removed files after apply succeeded.
+func (m *manifest) apply(added, removed []string) error {
+	edit := manifestEdit{}
+	for _, filename := range added {
+		edit.Added = append(edit.Added, path.Base(filename))
+	}
+	for _, filename := range removed {
+		edit.Removed = append(edit.Removed, path.Base(filename))
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if err := m.log.Append(context.Background(), edit); err != nil {
+		m.log.Resume()
+		return err
+	}
+	m.replay(edit)
+	if m.edits++; m.edits > len(m.files)+manifestRewriteThreshold {
+		// the edit has been recorded already, a failed rewrite is repeated with the next edit
+		if err := m.rewriteLocked(); err != nil {
+			log.Printf("[memtable] rewrite of %s failed: %v\n", m.filename, err)
+		}
+	}
+	return nil
+}
+
+// rewriteLocked replaces the manifest with a single edit adding the live files. The new manifest is written to a
+// temporary file, which replaces the old one by a rename. The old manifest stays in use until the new one has been
+// opened.
+func (m *manifest) rewriteLocked() error {
+	snapshot, err := messagelog.NewMessageLog[manifestEdit](m.filename+".tmp", manifestLogOptions...)
+	if err == nil {
+		_, err = snapshot.Open(messagelog.Noop[manifestEdit]())
+	}
+	if err == nil {
+		err = snapshot.Append(context.Background(), manifestEdit{Added: slices.Sorted(maps.Keys(m.files))})
+		if closeErr := snapshot.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		os.Remove(m.filename + ".tmp")
+		return err
+	}
+	if err = os.Rename(m.filename+".tmp", m.filename); err != nil {
+		os.Remove(m.filename + ".tmp")
+		return err
+	}
+	rewritten := &manifest{filename: m.filename, files: make(map[string]bool)}
+	if err = rewritten.open(); err != nil {
+		return err
+	}
+	m.log.Close()
+	m.log, m.files, m.edits = rewritten.log, rewritten.files, rewritten.edits
+	return fsutil.SyncDir(m.filename)
+}
+
+// live reports whether a file is live
+func (m *manifest) live(filename string) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.files[path.Base(filename)]
+}
+
+// tables returns the numbers of the live tables of the memtable name in ascending order
+func (m *manifest) tables(name string) []int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	pattern := regexp.MustCompile(fmt.Sprintf(`^%s\.(\d+)\.sst$`, regexp.QuoteMeta(name)))
+	numbers := make([]int, 0)
+	for file := range m.files {
+		if matches := pattern.FindStringSubmatch(file); matches != nil {
+			n, _ := strconv.Atoi(matches[1])
+			numbers = append(numbers, n)
+		}
+	}
+	slices.Sort(numbers)
+	return numbers
+}
+
+// collectGarbage removes the logs, log segments and tables of the memtable of frs which are not live and sets
+// the number of frs to the live log
+func (m *manifest) collectGarbage(frs *fileRotationSequence) error {
+	logPattern := regexp.MustCompile(fmt.Sprintf(`^(%s\.(\d+)\.%s)(\.\d{20})?$`, regexp.QuoteMeta(frs.basename), regexp.QuoteMeta(frs.suffix)))
+	tablePattern := regexp.MustCompile(fmt.Sprintf(`^(%s\.\d+\.sst)(\.tmp)?$`, regexp.QuoteMeta(frs.basename)))
+	files, err := os.ReadDir(frs.basedir)
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		logMatch, tableMatch := logPattern.FindStringSubmatch(file.Name()), tablePattern.FindStringSubmatch(file.Name())
+		switch {
+		case file.IsDir() || (logMatch == nil && tableMatch == nil):
+		case logMatch != nil && m.live(logMatch[1]):
+		case tableMatch != nil && tableMatch[2] == "" && m.live(tableMatch[1]):
+		default:
+			log.Printf("[memtable] removing orphaned file %s\n", file.Name())
+			if err := os.Remove(path.Join(frs.basedir, file.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	liveLog := -1
+	for file := range m.files {
+		if matches := logPattern.FindStringSubmatch(file); matches != nil {
+			liveLog, _ = strconv.Atoi(matches[2])
+		}
+	}
+	if liveLog >= 0 {
+		frs.currentIndex = liveLog
+	}
+	return nil
+}
+
+func (m *manifest) close() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.log.Close()
+}
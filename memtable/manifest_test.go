@@ -0,0 +1,143 @@
+package memtable
+
+import (
+	"context"
+	"github.com/mwildt/goodb/utils/testutils"
+	"os"
+	"path"
+	"slices"
+	"testing"
+)
+
+func TestManifest_OrphanedFiles(t *testing.T) {
+	testutils.RunWithTempDir("TestManifest_OrphanedFiles", func(dir string) {
+		options := []ConfigOption{WithDatadir(dir), WithFlushThreshold(1000)}
+		mt, err := CreateMemtable[int, int]("testmt", options...)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		for i := 0; i < 20; i++ {
+			mt.Set(context.Background(), i, i)
+		}
+		testutils.AssertNoError(t, mt.compact(), "Fehler beim flush")
+		mt.Set(context.Background(), 20, 20)
+		mt.Close()
+
+		// files of an interrupted flush or compaction, which have not been recorded in the manifest
+		orphans := []string{"testmt.9.mtlog", "testmt.7.sst", "testmt.8.sst.tmp"}
+		for _, orphan := range orphans {
+			os.WriteFile(path.Join(dir, orphan), []byte("incomplete"), 0644)
+		}
+		other := path.Join(dir, "other.3.sst")
+		os.WriteFile(other, []byte("other"), 0644)
+
+		reopend, err := CreateMemtable[int, int]("testmt", options...)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		for _, orphan := range orphans {
+			_, err := os.Stat(path.Join(dir, orphan))
+			testutils.Assert(t, os.IsNotExist(err), "orphaned file %s has not been removed", orphan)
+		}
+		_, err = os.Stat(other)
+		testutils.AssertNoError(t, err, "file of another memtable has been removed")
+		testutils.Assert(t, len(reopend.snapshotTables()) == 1, "expected 1 table, but got %d", len(reopend.snapshotTables()))
+		value, _ := reopend.Get(20)
+		testutils.Assert(t, value == 20 && reopend.Size() == 21, "unexpected memtable after recovery")
+		reopend.Close()
+	})
+}
+
+func TestManifest_Bootstrap(t *testing.T) {
+	testutils.RunWithTempDir("TestManifest_Bootstrap", func(dir string) {
+		options := []ConfigOption{WithDatadir(dir), WithFlushThreshold(1000)}
+		mt, err := CreateMemtable[int, int]("testmt", options...)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		for i := 0; i < 20; i++ {
+			mt.Set(context.Background(), i, i)
+		}
+		testutils.AssertNoError(t, mt.compact(), "Fehler beim flush")
+		mt.Set(context.Background(), 20, 20)
+		mt.Close()
+
+		// a directory written without a manifest is recorded as it is
+		os.Remove(path.Join(dir, "testmt.manifest"))
+		reopend, err := CreateMemtable[int, int]("testmt", options...)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		testutils.Assert(t, reopend.manifest.bootstrapped, "manifest has not been created")
+		testutils.Assert(t, len(reopend.manifest.tables("testmt")) == 1, "table has not been recorded")
+		testutils.Assert(t, reopend.manifest.live(reopend.frs.CurrentFilename()), "log has not been recorded")
+		testutils.Assert(t, reopend.Size() == 21, "expected 21 entries, but got %d", reopend.Size())
+		reopend.Close()
+	})
+}
+
+func TestManifest_BootstrapDamagedLog(t *testing.T) {
+	testutils.RunWithTempDir("TestManifest_BootstrapDamagedLog", func(dir string) {
+		mt, err := CreateMemtable[int, int]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		for i := 0; i < 20; i++ {
+			mt.Set(context.Background(), i, i)
+		}
+		mt.Close()
+
+		// an interrupted compaction left a partially written log next to the log it replaces
+		os.Remove(path.Join(dir, "testmt.manifest"))
+		content, _ := os.ReadFile(path.Join(dir, "testmt.0.mtlog"))
+		os.WriteFile(path.Join(dir, "testmt.1.mtlog"), content[:len(content)-3], 0644)
+		reopend, err := CreateMemtable[int, int]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		testutils.Assert(t, reopend.frs.CurrentFilename() == path.Join(dir, "testmt.0.mtlog"), "damaged log has been recorded")
+		testutils.Assert(t, reopend.Size() == 20, "expected 20 entries, but got %d", reopend.Size())
+		_, err = os.Stat(path.Join(dir, "testmt.1.mtlog"))
+		testutils.Assert(t, os.IsNotExist(err), "damaged log has not been removed")
+		reopend.Close()
+	})
+}
+
+func TestManifest_Rewrite(t *testing.T) {
+	testutils.RunWithTempDir("TestManifest_Rewrite", func(dir string) {
+		frs, err := initFileRotationSequence(dir, "testmt", "mtlog")
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der sequenz")
+		m, err := openManifest(frs)
+		testutils.AssertNoError(t, err, "Fehler beim öffnen des manifests")
+		for i := 1; i <= 2*manifestRewriteThreshold; i++ {
+			previous := tableFilename(dir, "testmt", i-1)
+			testutils.AssertNoError(t, m.apply([]string{tableFilename(dir, "testmt", i)}, []string{previous}), "Fehler beim schreiben")
+		}
+		testutils.Assert(t, m.edits < manifestRewriteThreshold+2, "manifest has not been rewritten, %d edits", m.edits)
+		m.close()
+
+		reopend, err := openManifest(frs)
+		testutils.AssertNoError(t, err, "Fehler beim öffnen des manifests")
+		tables := reopend.tables("testmt")
+		testutils.Assert(t, slices.Equal(tables, []int{2 * manifestRewriteThreshold}), "unexpected tables %v", tables)
+		testutils.Assert(t, reopend.live(frs.CurrentFilename()), "log has not been recorded")
+		reopend.close()
+	})
+}
+
+func TestManifest_FailedRewrite(t *testing.T) {
+	testutils.RunWithTempDir("TestManifest_FailedRewrite", func(dir string) {
+		frs, err := initFileRotationSequence(dir, "testmt", "mtlog")
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der sequenz")
+		m, err := openManifest(frs)
+		testutils.AssertNoError(t, err, "Fehler beim öffnen des manifests")
+
+		// the temporary file of the rewrite can't be created, the edits are recorded anyway
+		os.MkdirAll(path.Join(m.filename+".tmp", "blocked"), 0755)
+		for i := 1; i <= 2*manifestRewriteThreshold; i++ {
+			previous := tableFilename(dir, "testmt", i-1)
+			testutils.AssertNoError(t, m.apply([]string{tableFilename(dir, "testmt", i)}, []string{previous}), "Fehler beim schreiben")
+		}
+		testutils.Assert(t, m.edits > 2*manifestRewriteThreshold, "manifest has been rewritten, %d edits", m.edits)
+
+		os.RemoveAll(m.filename + ".tmp")
+		last := 2*manifestRewriteThreshold + 1
+		testutils.AssertNoError(t, m.apply([]string{tableFilename(dir, "testmt", last)}, []string{tableFilename(dir, "testmt", last-1)}), "Fehler beim schreiben")
+		testutils.Assert(t, m.edits == 1, "manifest has not been rewritten, %d edits", m.edits)
+		m.close()
+
+		reopend, err := openManifest(frs)
+		testutils.AssertNoError(t, err, "Fehler beim öffnen des manifests")
+		tables := reopend.tables("testmt")
+		testutils.Assert(t, slices.Equal(tables, []int{last}), "unexpected tables %v", tables)
+		reopend.close()
+	})
+}
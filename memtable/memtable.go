@@ -1,188 +1,787 @@
 // Contains a simple key-value store for saving object data with a key. Persistence takes place via a simple
-// write-ahead-log. All data is also stored in a skip-list in the memory.
+// write-ahead-log. All data is also stored in a skip-list in the memory, unless a flush threshold is configured:
+// then the skip-list is flushed to sorted table files on disk (log-structured merge tree).
 package memtable
 
 import (
+	"cmp"
 	"context"
+	"errors"
+	"fmt"
 	"github.com/mwildt/goodb/base"
 	"github.com/mwildt/goodb/codecs"
 	"github.com/mwildt/goodb/messagelog"
 	"github.com/mwildt/goodb/skiplist"
+	"github.com/mwildt/goodb/sstable"
 	"golang.org/x/exp/constraints"
+	"iter"
 	"log"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// ErrClosed is returned when a closed memtable is used
+var ErrClosed = errors.New("memtable closed")
+
 type entryType int8
 
 const (
 	delete entryType = 0
 	write  entryType = 1
+	batch  entryType = 2
 )
 
 type memtableMessage[K constraints.Ordered, V any] struct {
+	Type      entryType
+	Key       K
+	Value     V
+	Batch     []memtableMessage[K, V] `json:",omitempty"`
+	Sequence  uint64                  `json:",omitempty"`
+	Timestamp int64                   `json:",omitempty"` // unix nanoseconds
+	Version   uint64                  `json:",omitempty"`
+	ExpiresAt int64                   `json:",omitempty"` // unix nanoseconds
+}
+
+// mutation is the decoded form of a single write or delete
+type mutation[K constraints.Ordered, V any] struct {
 	Type  entryType
 	Key   K
 	Value V
+	Meta  base.Metadata
+	TTL   time.Duration // requested time-to-live of a new write, the default is used if zero
+}
+
+// record is the value stored in the index
+type record[V any] struct {
+	value     V
+	meta      base.Metadata
+	position  int  // offset of the log record containing the value
+	tombstone bool // the key has been deleted, it hides older records of the tables
 }
 
 // Memtable A simple memtable implementation using a skiplist in-memory index and write ahead log for persistence
 type Memtable[K constraints.Ordered, V any] struct {
 	name              string
-	index             *skiplist.SkipList[K, V]
+	index             *skiplist.ConcurrentSkipList[K, record[V]]
 	log               *messagelog.MessageLog[memtableMessage[K, []byte]]
-	mutex             *sync.Mutex
+	mutex             *sync.Mutex // serializes writers and compaction
+	closed            bool
+	stop              chan struct{} // closed to stop background routines
+	watchers          []*watcher[K, V]
+	outbox            []outboxEntry[K, V]
+	indexes           []secondaryIndex[K, V]
+	logOptions        []messagelog.Option
+	sequence          uint64 // sequence of the last stamped mutation
 	frs               *fileRotationSequence
+	manifest          *manifest // live log and tables
 	compactThreshold  int
 	enableAutoCompact bool
+	segmented         bool // compaction removes old segments instead of rewriting the log
+	segmentCount      int  // number of segments after the last compaction
+	defaultTTL        time.Duration
 	codec             codecs.Codec[V]
+	flushThreshold    int            // number of index records which triggers a flush, 0 keeps all data in memory
+	tables            []*lsmTable[K] // flushed and compacted tables in read order
+	tablesMutex       *sync.RWMutex
+	tableFiles        *fileRotationSequence // numbers of the tables
+	tableOptions      []sstable.Option
+	compaction        CompactionStrategy
+	compactionMutex   *sync.Mutex // serializes compactions of the tables
+	migrations        int         // number of migrations, recorded in the tables
+	expiring          atomic.Bool // a record with an expiry has been applied, so Size has to skip expired records
 }
 
 // CreateMemtable create a new instance of Memtable
-func CreateMemtable[K constraints.Ordered, V any](name string, options ...ConfigOption) (*Memtable[K, V], error) {
+func CreateMemtable[K constraints.Ordered, V any](name string, options ...ConfigOption) (_ *Memtable[K, V], err error) {
 	config := newConfig(options)
 	frs, err := initFileRotationSequence(config.datadir, name, config.logSuffix)
 	if err != nil {
 		return nil, err
 	}
+	manifest, err := openManifest(frs)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			manifest.close()
+		}
+	}()
+	codec, err := valueCodec[V](config)
+	if err != nil {
+		return nil, err
+	}
+	format, openFormat := config.logFormat(), config.logFormat()
+	if config.recordFormat == nil || config.keyRing != nil {
+		if openFormat, codec, err = detectCodecs[K](frs.CurrentFilename(), format, codec, config); err != nil {
+			return nil, err
+		}
+	}
+	logOptions := append(config.logOptions(), messagelog.WithCodec[memtableMessage[K, []byte]](newMessageCodec[K](format, codec)))
+	openOptions := append(config.logOptions(), messagelog.WithCodec[memtableMessage[K, []byte]](newMessageCodec[K](openFormat, codec)))
+	if config.keyRing != nil && !encrypted(openFormat) {
+		// no unencrypted log is kept once encryption has been configured
+		if err = convertLog[K](frs, manifest, openOptions, logOptions); err != nil {
+			return nil, err
+		}
+		openOptions = logOptions
+	}
+
+	tableOptions := tableOptions[K](config, codec)
 
 	if len(config.migrations) > 0 {
 		if migman, err := NewMigrationManager[K, MigrationObject](name, frs, codecs.NewJsonCodec[MigrationObject](), config.migrations...); err != nil {
 			return nil, err
-		} else if err = migman.migrate(context.Background()); err != nil {
-			return nil, err
+		} else {
+			migman.logOptions = openOptions
+			migman.tableOptions = tableOptions
+			migman.manifest = manifest
+			if err = migman.migrate(context.Background()); err != nil {
+				return nil, err
+			}
 		}
 	}
 
-	if messageLog, err := messagelog.NewMessageLog[memtableMessage[K, []byte]](frs.CurrentFilename()); err != nil {
+	indexes, err := buildIndexes[K, V](config.indexes)
+	if err != nil {
+		return nil, err
+	}
+
+	if messageLog, err := messagelog.NewMessageLog[memtableMessage[K, []byte]](frs.CurrentFilename(), openOptions...); err != nil {
 		return nil, err
 	} else {
 		repo := &Memtable[K, V]{
 			name:              name,
-			index:             skiplist.NewSkipList[K, V](),
+			index:             skiplist.NewConcurrentSkipList[K, record[V]](),
 			log:               messageLog,
 			mutex:             &sync.Mutex{},
 			frs:               frs,
+			manifest:          manifest,
 			compactThreshold:  config.compactThreshold,
 			enableAutoCompact: config.enableAutoCompact,
-			codec:             codecs.NewJsonCodec[V](),
+			segmented:         config.segmented(),
+			defaultTTL:        config.defaultTTL,
+			stop:              make(chan struct{}),
+			watchers:          make([]*watcher[K, V], 0),
+			indexes:           indexes,
+			logOptions:        logOptions,
+			codec:             codec,
+			flushThreshold:    config.flushThreshold,
+			tablesMutex:       &sync.RWMutex{},
+			tableOptions:      tableOptions,
+			compaction:        config.compaction,
+			compactionMutex:   &sync.Mutex{},
+			migrations:        len(config.migrations),
+		}
+		if err := repo.init(); err != nil {
+			return repo, err
 		}
-		return repo, repo.init()
+		go repo.reapExpired(config.reaperInterval)
+		go repo.compactTables()
+		return repo, nil
 	}
 }
 
 func (mt *Memtable[K, V]) init() error {
-
+	if err := mt.loadTables(); err != nil {
+		return err
+	}
+	mt.restoreSecondaryIndexes()
+	position := mt.log.FirstOffset()
 	n, err := mt.log.Open(func(ctx context.Context, message memtableMessage[K, []byte]) error {
-		switch message.Type {
-		case write:
-			if decoded, err := mt.codec.Decode(message.Value); err != nil {
-				return err
-			} else {
-				mt.index.Set(message.Key, decoded)
+		// all mutations of a record are decoded before the first one is applied
+		if mutations, err := mt.decode(message); err != nil {
+			return err
+		} else if err := mt.restoreMetadata(mutations); err != nil {
+			return err
+		} else {
+			for _, m := range mutations {
+				if old, existed, err := mt.current(m.Key); err != nil {
+					return err
+				} else {
+					mt.applyToIndex(m, position, old, existed)
+				}
 			}
-		case delete:
-			mt.index.Delete(message.Key)
+			// the sequence record of a compacted log keeps the sequences of removed records in use
+			mt.sequence = max(mt.sequence, message.Sequence)
 		}
+		position++
 		return nil
 	})
+	mt.segmentCount = len(mt.log.Segments())
 	log.Printf("Memtable loaded %d records from %s\n", n, mt.log.GetFilename())
 	return err
 }
 
+// encode converts the mutations into a single log record. More than one mutation results in a batch record.
+func (mt *Memtable[K, V]) encode(mutations []mutation[K, V]) (message memtableMessage[K, []byte], err error) {
+	messages := make([]memtableMessage[K, []byte], len(mutations))
+	for i, m := range mutations {
+		messages[i] = memtableMessage[K, []byte]{
+			Type:     m.Type,
+			Key:      m.Key,
+			Value:    []byte{},
+			Sequence: m.Meta.Sequence,
+			Version:  m.Meta.Version,
+		}
+		if !m.Meta.Timestamp.IsZero() {
+			messages[i].Timestamp = m.Meta.Timestamp.UnixNano()
+		}
+		if !m.Meta.ExpiresAt.IsZero() {
+			messages[i].ExpiresAt = m.Meta.ExpiresAt.UnixNano()
+		}
+		if m.Type == write {
+			if messages[i].Value, err = mt.codec.Encode(m.Value); err != nil {
+				return message, err
+			}
+		}
+	}
+	if len(messages) == 1 {
+		return messages[0], nil
+	}
+	return memtableMessage[K, []byte]{Type: batch, Value: []byte{}, Batch: messages}, nil
+}
+
+// decode converts a log record into the mutations it contains
+func (mt *Memtable[K, V]) decode(message memtableMessage[K, []byte]) (mutations []mutation[K, V], err error) {
+	meta := base.Metadata{Sequence: message.Sequence, Version: message.Version}
+	if message.Timestamp != 0 {
+		meta.Timestamp = time.Unix(0, message.Timestamp)
+	}
+	if message.ExpiresAt != 0 {
+		meta.ExpiresAt = time.Unix(0, message.ExpiresAt)
+	}
+	switch message.Type {
+	case write:
+		if decoded, err := mt.codec.Decode(message.Value); err != nil {
+			return mutations, err
+		} else {
+			return append(mutations, mutation[K, V]{Type: write, Key: message.Key, Value: decoded, Meta: meta}), nil
+		}
+	case delete:
+		return append(mutations, mutation[K, V]{Type: delete, Key: message.Key, Meta: meta}), nil
+	case batch:
+		for _, nested := range message.Batch {
+			if decoded, err := mt.decode(nested); err != nil {
+				return mutations, err
+			} else {
+				mutations = append(mutations, decoded...)
+			}
+		}
+	}
+	return mutations, nil
+}
+
+// stampLocked assigns sequence, timestamp and version to new mutations. The caller must hold mt.mutex.
+func (mt *Memtable[K, V]) stampLocked(mutations []mutation[K, V]) ([]mutation[K, V], error) {
+	stamped := make([]mutation[K, V], len(mutations))
+	now := time.Now()
+	versions := make(map[K]uint64)
+	for i, m := range mutations {
+		version, seen := versions[m.Key]
+		if !seen {
+			if rec, found, err := mt.lookupLocked(m.Key); err != nil {
+				return nil, err
+			} else if found {
+				version = rec.meta.Version
+			}
+		}
+		if m.Type == write {
+			version++
+		} else {
+			version = 0
+		}
+		versions[m.Key] = version
+		mt.sequence++
+		m.Meta = base.Metadata{Sequence: mt.sequence, Timestamp: now, Version: version}
+		if ttl := cmp.Or(m.TTL, mt.defaultTTL); m.Type == write && ttl > 0 {
+			m.Meta.ExpiresAt = now.Add(ttl)
+		}
+		stamped[i] = m
+	}
+	return stamped, nil
+}
+
+// restoreMetadata completes the metadata of replayed mutations. Records written before sequence numbers and
+// versions have been persisted are numbered in log order.
+func (mt *Memtable[K, V]) restoreMetadata(mutations []mutation[K, V]) error {
+	for i := range mutations {
+		m := &mutations[i]
+		if m.Meta.Sequence == 0 {
+			m.Meta.Sequence = mt.sequence + 1
+		}
+		if m.Type == write && m.Meta.Version == 0 {
+			rec, _, err := mt.lookup(m.Key)
+			if err != nil {
+				return err
+			}
+			m.Meta.Version = rec.meta.Version + 1
+		}
+		mt.sequence = max(mt.sequence, m.Meta.Sequence)
+	}
+	return nil
+}
+
+// applyToIndex applies a single mutation to the in-memory index and the secondary indexes. Writes which are
+// already expired remove the key. old is the current record of the key, it returns old if it is still visible.
+// position is the offset of the log record containing the mutation.
+func (mt *Memtable[K, V]) applyToIndex(m mutation[K, V], position int, old record[V], existed bool) (record[V], bool) {
+	now := time.Now()
+	if existed {
+		for _, idx := range mt.indexes {
+			idx.remove(m.Key, old.value)
+		}
+	}
+	rec := record[V]{value: m.Value, meta: m.Meta, position: position}
+	if !m.Meta.ExpiresAt.IsZero() {
+		mt.expiring.Store(true)
+	}
+	switch m.Type {
+	case write:
+		if rec.expired(now) {
+			mt.removeFromIndex(m.Key, m.Meta, position)
+		} else {
+			mt.index.Set(m.Key, rec)
+			for _, idx := range mt.indexes {
+				idx.insert(m.Key, m.Value)
+			}
+		}
+	case delete:
+		mt.removeFromIndex(m.Key, m.Meta, position)
+	}
+	if existed && old.expired(now) {
+		return record[V]{}, false
+	}
+	return old, existed
+}
+
+// write runs prepare under mt.mutex and writes the mutations it returns as one record. Returning no mutations
+// skips the write. The mutex is released while the record is flushed, so concurrent writers share a group commit.
+func (mt *Memtable[K, V]) write(ctx context.Context, prepare func() ([]mutation[K, V], error)) error {
+	mt.mutex.Lock()
+	mutations, err := prepare()
+	if err != nil || len(mutations) == 0 {
+		mt.mutex.Unlock()
+		return err
+	}
+	pending, err := mt.writeLocked(ctx, mutations...)
+	mt.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	err = pending.Wait()
+	mt.mutex.Lock()
+	mt.applyWrittenLocked()
+	mt.mutex.Unlock()
+	mt.awaitDelivery(ctx)
+	return err
+}
+
+// writeLocked enqueues the mutations as one record to the log. They are applied to the index by
+// applyWrittenLocked once the record has been written, until then they are only visible to writers preparing
+// further mutations. The caller must hold mt.mutex.
+func (mt *Memtable[K, V]) writeLocked(ctx context.Context, mutations ...mutation[K, V]) (*messagelog.Pending, error) {
+	exists := func(key K) (bool, error) {
+		_, found, err := mt.lookupLocked(key)
+		return found, err
+	}
+	// the mutations of the outbox have been validated already, they only claim their index keys
+	queued := make([]mutation[K, V], 0)
+	for _, entry := range mt.outbox {
+		queued = append(queued, entry.mutations...)
+	}
+	for _, idx := range mt.indexes {
+		if err := idx.validate(append(slices.Clip(queued), mutations...), exists); err != nil {
+			return nil, err
+		}
+	}
+	mutations, err := mt.stampLocked(mutations)
+	if err != nil {
+		return nil, err
+	}
+	replaced, err := mt.replacedLocked(mutations)
+	if err != nil {
+		return nil, err
+	}
+	message, err := mt.encode(mutations)
+	if err != nil {
+		return nil, err
+	}
+	pending, err := mt.log.Enqueue(ctx, message)
+	if err != nil {
+		return nil, err
+	}
+	mt.outbox = append(mt.outbox, outboxEntry[K, V]{pending, mutations, replaced})
+	go mt.autoCompaction()
+	return pending, nil
+}
+
+// applyLocked applies the mutations of a written record to the index and returns their change events. The caller
+// must hold mt.mutex.
+func (mt *Memtable[K, V]) applyLocked(entry outboxEntry[K, V]) []ChangeEvent[K, V] {
+	events := make([]ChangeEvent[K, V], 0)
+	for i, m := range entry.mutations {
+		old, existed := mt.applyToIndex(m, entry.pending.Offset(), entry.replaced[i].rec, entry.replaced[i].found)
+		if len(mt.watchers) == 0 {
+			continue
+		} else if m.Type == write {
+			events = append(events, ChangeEvent[K, V]{OperationSet, m.Key, old.value, m.Value, existed, m.Meta.Sequence})
+		} else if existed {
+			events = append(events, ChangeEvent[K, V]{OperationDelete, m.Key, old.value, m.Value, existed, m.Meta.Sequence})
+		}
+	}
+	return events
+}
+
+// replaced is the record of a key before a mutation
+type replaced[V any] struct {
+	rec   record[V]
+	found bool
+}
+
+// replacedLocked reads the records replaced by the mutations before they are written, so a failed read of a
+// table rejects the write. A key mutated twice replaces the record of its earlier mutation, a key of a queued
+// record the record of its queued mutation. The caller must hold mt.mutex.
+func (mt *Memtable[K, V]) replacedLocked(mutations []mutation[K, V]) ([]replaced[V], error) {
+	result := make([]replaced[V], len(mutations))
+	earlier := make(map[K]mutation[K, V])
+	now := time.Now()
+	for i, m := range mutations {
+		if prior, found := earlier[m.Key]; found {
+			rec := record[V]{value: prior.Value, meta: prior.Meta}
+			result[i] = replaced[V]{rec, prior.Type == write && !rec.expired(now)}
+		} else if rec, found, err := mt.currentLocked(m.Key); err != nil {
+			return nil, err
+		} else {
+			result[i] = replaced[V]{rec, found}
+		}
+		earlier[m.Key] = m
+	}
+	return result, nil
+}
+
 // Set e key value pair. Existing entries will be replaced
 func (mt *Memtable[K, V]) Set(ctx context.Context, key K, value V) (result V, err error) {
-	if encoded, err := mt.codec.Encode(value); err != nil {
-		return result, err
-	} else {
-		entry := memtableMessage[K, []byte]{write, key, encoded}
-		if err := mt.log.Append(ctx, entry); err != nil {
-			return value, err
-		} else {
-			mt.index.Set(key, value)
-			defer func() {
-				go mt.autoCompaction()
-			}()
-			return value, err
+	return value, mt.write(ctx, func() ([]mutation[K, V], error) {
+		return []mutation[K, V]{{Type: write, Key: key, Value: value}}, nil
+	})
+}
+
+// lookup returns the record of key from the index or the tables. Expired records are reported as absent.
+func (mt *Memtable[K, V]) lookup(key K) (rec record[V], found bool, err error) {
+	return visible(mt.current(key))
+}
+
+// lookupLocked is lookup for writers, which see the mutations of queued records as well. The caller must hold
+// mt.mutex.
+func (mt *Memtable[K, V]) lookupLocked(key K) (rec record[V], found bool, err error) {
+	return visible(mt.currentLocked(key))
+}
+
+// visible reports expired records as absent
+func visible[V any](rec record[V], found bool, err error) (record[V], bool, error) {
+	if found && rec.expired(time.Now()) {
+		return record[V]{}, false, err
+	}
+	return rec, found, err
+}
+
+// currentLocked returns the record of the latest queued mutation of key, or the current record if there is none.
+// The caller must hold mt.mutex.
+func (mt *Memtable[K, V]) currentLocked(key K) (rec record[V], found bool, err error) {
+	for _, entry := range slices.Backward(mt.outbox) {
+		for _, m := range slices.Backward(entry.mutations) {
+			if m.Key == key {
+				rec := record[V]{value: m.Value, meta: m.Meta, position: entry.pending.Offset(), tombstone: m.Type == delete}
+				return rec, m.Type == write, nil
+			}
+		}
+	}
+	return mt.current(key)
+}
+
+// current returns the latest record of key, including expired records. The index is searched before the tables,
+// so a record moved to a table by a concurrent flush is found in one of both.
+func (mt *Memtable[K, V]) current(key K) (rec record[V], found bool, err error) {
+	if rec, found = mt.index.Get(key); found || mt.flushThreshold == 0 {
+		return rec, found && !rec.tombstone, nil
+	}
+	tables, release := mt.acquireTables()
+	defer release()
+	for _, table := range tables {
+		if data, found, err := table.Get(key); err != nil {
+			return rec, false, fmt.Errorf("reading %s failed: %w", table.Filename(), err)
+		} else if found {
+			if rec, err = mt.decodeRecord(data); err != nil {
+				return rec, false, fmt.Errorf("reading %s failed: %w", table.Filename(), err)
+			}
+			return rec, !rec.tombstone, nil
 		}
 	}
+	return rec, false, nil
+}
+
+// removeFromIndex removes key from the index. With tables a tombstone replaces the record, so older records of
+// the tables stay hidden.
+func (mt *Memtable[K, V]) removeFromIndex(key K, meta base.Metadata, position int) {
+	if mt.flushThreshold > 0 {
+		mt.index.Set(key, record[V]{meta: meta, position: position, tombstone: true})
+	} else {
+		mt.index.Delete(key)
+	}
 }
 
 // Get finds an existing element
 func (mt *Memtable[K, V]) Get(key K) (value V, found bool) {
-	return mt.index.Get(key)
+	rec, found := mt.read(key)
+	return rec.value, found
+}
+
+// GetWithMeta finds an existing element together with the metadata of its last modification
+func (mt *Memtable[K, V]) GetWithMeta(key K) (value V, meta base.Metadata, found bool) {
+	rec, found := mt.read(key)
+	return rec.value, rec.meta, found
+}
+
+// read looks up key for the reads, which don't return errors. A failed read of a table is logged and reported as
+// absent.
+func (mt *Memtable[K, V]) read(key K) (rec record[V], found bool) {
+	rec, found, err := mt.lookup(key)
+	if err != nil {
+		log.Printf("[memtable] %v\n", err)
+	}
+	return rec, found
 }
 
 // Delete removes an existing element by key and returns true if one was deleted
 func (mt *Memtable[K, V]) Delete(ctx context.Context, key K) (bool, error) {
-	entry := memtableMessage[K, []byte]{delete, key, []byte{}}
-	if err := mt.log.Append(ctx, entry); err != nil {
-		return false, err
-	} else {
-		return mt.index.Delete(key), nil
+	var found bool
+	err := mt.write(ctx, func() ([]mutation[K, V], error) {
+		var err error
+		_, found, err = mt.lookupLocked(key)
+		return []mutation[K, V]{{Type: delete, Key: key}}, err
+	})
+	return found && err == nil, err
+}
+
+// Range returns the entries with keys between from and to. Bounds, order and limit are controlled by opts.
+func (mt *Memtable[K, V]) Range(from, to K, opts base.RangeOptions) []base.Entry[K, V] {
+	entries := make([]base.Entry[K, V], 0)
+	for key, value := range unwrapSeq(mt.indexRange(from, to, opts)) {
+		entries = append(entries, base.Entry[K, V]{Key: key, Value: value})
+		if len(entries) == opts.Limit {
+			break
+		}
 	}
+	return entries
 }
 
 func (mt *Memtable[K, V]) Keys() <-chan K {
-	return mt.index.Keys()
+	ch := make(chan K)
+	go func() {
+		for key := range mt.KeysSeq() {
+			ch <- key
+		}
+		close(ch)
+	}()
+	return ch
 }
 
 func (mt *Memtable[K, V]) Values() <-chan V {
-	return mt.index.Values()
+	ch := make(chan V)
+	go func() {
+		for value := range mt.ValuesSeq() {
+			ch <- value
+		}
+		close(ch)
+	}()
+	return ch
+}
+
+// All returns an iterator over all key-value pairs in ascending key order
+func (mt *Memtable[K, V]) All() iter.Seq2[K, V] {
+	return unwrapSeq(mt.records(mt.index.All(), (*lsmTable[K]).All, false))
+}
+
+// KeysSeq returns an iterator over all keys in ascending order
+func (mt *Memtable[K, V]) KeysSeq() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for key := range mt.All() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// ValuesSeq returns an iterator over all values in ascending key order
+func (mt *Memtable[K, V]) ValuesSeq() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, value := range mt.All() {
+			if !yield(value) {
+				return
+			}
+		}
+	}
+}
+
+// Backward returns an iterator over all key-value pairs in descending key order
+func (mt *Memtable[K, V]) Backward() iter.Seq2[K, V] {
+	return unwrapSeq(mt.records(mt.index.Backward(), (*lsmTable[K]).Backward, true))
 }
 
 func (mt *Memtable[K, V]) Entries() []base.Entry[K, V] {
-	return mt.index.Entries()
+	if mt.flushThreshold > 0 {
+		return slices.Collect(func(yield func(base.Entry[K, V]) bool) {
+			for key, value := range mt.All() {
+				if !yield(base.Entry[K, V]{Key: key, Value: value}) {
+					return
+				}
+			}
+		})
+	}
+	return unwrapEntries(mt.index.Entries())
 }
 
+// unwrapEntries converts index entries to value entries and drops expired and deleted records
+func unwrapEntries[K constraints.Ordered, V any](records []base.Entry[K, record[V]]) []base.Entry[K, V] {
+	now := time.Now()
+	entries := make([]base.Entry[K, V], 0, len(records))
+	for _, entry := range records {
+		if !entry.Value.expired(now) && !entry.Value.tombstone {
+			entries = append(entries, base.Entry[K, V]{Key: entry.Key, Value: entry.Value.value})
+		}
+	}
+	return entries
+}
+
+// unwrapSeq converts an index iterator to a value iterator which skips expired and deleted records
+func unwrapSeq[K constraints.Ordered, V any](records iter.Seq2[K, record[V]]) iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for key, rec := range records {
+			if !rec.expired(time.Now()) && !rec.tombstone && !yield(key, rec.value) {
+				return
+			}
+		}
+	}
+}
+
+// Size returns the number of keys which are neither deleted nor expired. Without tables and expiring records this
+// is the size of the index, otherwise the keys are counted by a scan.
 func (mt *Memtable[K, V]) Size() int {
-	return mt.index.Size()
+	if mt.flushThreshold == 0 && !mt.expiring.Load() {
+		return mt.index.Size()
+	}
+	count := 0
+	for range mt.All() {
+		count++
+	}
+	return count
 }
 
 func (mt *Memtable[K, V]) Close() error {
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+	if !mt.closed {
+		close(mt.stop)
+	}
+	for _, w := range slices.Clone(mt.watchers) {
+		mt.unwatchLocked(w)
+	}
+	mt.closed = true
+	// a running compaction stops at mt.stop, the tables are closed when the last reader has released them
+	mt.compactionMutex.Lock()
+	tables := mt.snapshotTables()
+	mt.tablesMutex.Lock()
+	mt.tables = nil
+	mt.tablesMutex.Unlock()
+	mt.compactionMutex.Unlock()
+	for _, table := range tables {
+		table.release()
+	}
+	mt.manifest.close()
 	return mt.log.Close()
 }
 
 func (mt *Memtable[K, V]) autoCompaction() (err error) {
-	if !mt.enableAutoCompact {
+	if !mt.enableAutoCompact && mt.flushThreshold == 0 {
 		return nil
 	}
-	if mt.log.MessageCount() >= mt.index.Size()+mt.compactThreshold {
-		return mt.compact()
+	// events published by the compaction are delivered after the mutex has been released
+	defer mt.awaitDelivery(context.Background())
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+	if mt.closed {
+		return nil
+	} else if mt.flushThreshold > 0 {
+		if mt.index.Size() >= mt.flushThreshold {
+			return mt.flushLocked()
+		}
+		return nil
+	} else if !mt.enableAutoCompact {
+		return nil
+	} else if mt.segmented && len(mt.log.Segments()) > mt.segmentCount {
+		return mt.compactSegmentsLocked()
+	} else if !mt.segmented && mt.log.MessageCount() >= mt.index.Size()+mt.compactThreshold {
+		return mt.compactLocked()
 	}
 	return nil
 }
 
 func (mt *Memtable[K, V]) compact() (err error) {
-
+	defer mt.awaitDelivery(context.Background())
 	mt.mutex.Lock()
 	defer mt.mutex.Unlock()
+	if mt.flushThreshold > 0 {
+		return mt.flushLocked()
+	} else if mt.segmented {
+		return mt.compactSegmentsLocked()
+	}
+	return mt.compactLocked()
+}
 
-	if mLog, err := messagelog.NewMessageLog[memtableMessage[K, []byte]](mt.frs.NextFilename()); err != nil {
+// compactLocked rewrites all index entries to a new log file, which replaces the old one in the manifest. The
+// entries are followed by an empty batch record with the last sequence, so sequences of deleted and expired records
+// are not assigned again after a restart. The offsets of the new log start at 0 again. The caller must hold mt.mutex.
+func (mt *Memtable[K, V]) compactLocked() (err error) {
+	mt.settleLocked()
+	mLog, err := messagelog.NewMessageLog[memtableMessage[K, []byte]](mt.frs.NextFilename(), mt.logOptions...)
+	if err != nil {
 		return err
-	} else if _, err = mLog.Open(messagelog.Noop[memtableMessage[K, []byte]]()); err != nil {
+	}
+	defer func() {
+		if err != nil {
+			mLog.Close()
+			mLog.Delete()
+		}
+	}()
+	if _, err = mLog.Open(messagelog.Noop[memtableMessage[K, []byte]]()); err != nil {
 		return err
-	} else {
-		entries := mt.index.Entries()
-		for _, entry := range entries {
-			if encoded, err := mt.codec.Encode(entry.Value); err != nil {
-				return err
-			} else {
-				message := memtableMessage[K, []byte]{write, entry.Key, encoded}
-				if err := mLog.Append(context.Background(), message); err != nil {
-					return err
-				}
-			}
-
+	}
+	now := time.Now()
+	for _, entry := range mt.index.Entries() {
+		if entry.Value.expired(now) {
+			continue
+		} else if message, err := mt.encode([]mutation[K, V]{{Type: write, Key: entry.Key, Value: entry.Value.value, Meta: entry.Value.meta}}); err != nil {
+			return err
+		} else if err := mLog.Append(context.Background(), message); err != nil {
+			return err
 		}
+	}
 
-		oldStore := mt.log
-		mt.log = mLog
-
-		defer func() {
-			oldStore.Close()
-			oldStore.Delete()
-		}()
-		return nil
+	marker := memtableMessage[K, []byte]{Type: batch, Value: []byte{}, Sequence: mt.sequence}
+	if err = mLog.Append(context.Background(), marker); err != nil {
+		return err
+	} else if err = mLog.Sync(); err != nil {
+		return err
+	} else if err = mt.manifest.apply([]string{mLog.GetFilename()}, []string{mt.log.GetFilename()}); err != nil {
+		return err
 	}
+	oldStore := mt.log
+	mt.log = mLog
+	oldStore.Close()
+	oldStore.Delete()
+	return nil
 }
@@ -2,8 +2,15 @@ package memtable
 
 import (
 	"context"
+	"fmt"
+	"github.com/mwildt/goodb/base"
+	"github.com/mwildt/goodb/messagelog"
 	"github.com/mwildt/goodb/utils/testutils"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestCreateMemtable(t *testing.T) {
@@ -106,8 +113,310 @@ func TestCompact(t *testing.T) {
 		}
 		testutils.Assert(t, mt.log.MessageCount() == 15, "message count should not be %d ", mt.log.MessageCount())
 		mt.compact()
-		testutils.Assert(t, mt.log.MessageCount() == 5, "message count should not be %d ", mt.log.MessageCount())
+		// the live records and the record of the last sequence
+		testutils.Assert(t, mt.log.MessageCount() == 6, "message count should not be %d ", mt.log.MessageCount())
 		testutils.Assert(t, mt.frs.CurrentFilename() == "testdata/testmt.1.mtlog", "wrong filename, expected, but got %s", mt.frs.CurrentFilename())
 
 	})
 }
+
+func TestRange(t *testing.T) {
+	testutils.RunWithTempDir("TestRange", func(dir string) {
+		mt, err := CreateMemtable[int, string]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		for i := 1; i <= 10; i++ {
+			mt.Set(context.Background(), i*100, "order")
+		}
+		mt.Delete(context.Background(), 500)
+
+		entries := mt.Range(300, 700, base.RangeOptions{ExcludeTo: true, Reverse: true})
+		testutils.Assert(t, len(entries) == 3, "expected 3 entries, but got %d", len(entries))
+		testutils.Assert(t, entries[0].Key == 600, "expected 600 as first key, but got %d", entries[0].Key)
+		testutils.Assert(t, entries[2].Key == 300, "expected 300 as last key, but got %d", entries[2].Key)
+		mt.Close()
+	})
+}
+
+func TestIterators(t *testing.T) {
+	testutils.RunWithTempDir("TestIterators", func(dir string) {
+		mt, err := CreateMemtable[string, int]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), "b", 2)
+		mt.Set(context.Background(), "a", 1)
+		mt.Set(context.Background(), "c", 3)
+
+		keys := ""
+		for key := range mt.KeysSeq() {
+			keys += key
+		}
+		testutils.Assert(t, keys == "abc", "expected keys abc, but got %s", keys)
+
+		keys = ""
+		for key, value := range mt.Backward() {
+			if value == 1 {
+				break
+			}
+			keys += key
+		}
+		testutils.Assert(t, keys == "cb", "expected keys cb, but got %s", keys)
+		mt.Close()
+	})
+}
+
+func TestConcurrentWrites(t *testing.T) {
+	testutils.RunWithTempDir("TestConcurrentWrites", func(dir string) {
+		mt, err := CreateMemtable[int, int]("testmt", WithDatadir(dir), WithCompactThreshold(10))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+
+		wg := sync.WaitGroup{}
+		for w := 0; w < 4; w++ {
+			wg.Add(1)
+			go func(offset int) {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					mt.Set(context.Background(), offset*100+i%10, i)
+					for range mt.All() {
+					}
+				}
+			}(w)
+		}
+		wg.Wait()
+		mt.Close()
+
+		reopend, err := CreateMemtable[int, int]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		testutils.Assert(t, reopend.Size() == 40, "expected 40 entries, but got %d", reopend.Size())
+		value, _ := reopend.Get(309)
+		testutils.Assert(t, value == 49, "expected last written value 49, but got %d", value)
+		reopend.Close()
+	})
+}
+
+func TestGetWithMeta(t *testing.T) {
+	testutils.RunWithTempDir("TestGetWithMeta", func(dir string) {
+		mt, err := CreateMemtable[string, string]("testmt", WithDatadir(dir), WithDisableAutoCompaction())
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		before := time.Now()
+		mt.Set(context.Background(), "a", "1")
+		mt.Set(context.Background(), "b", "1")
+		mt.Set(context.Background(), "a", "2")
+		mt.Apply(context.Background(), NewWriteBatch[string, string]().Put("a", "3").Put("a", "4"))
+
+		_, meta, found := mt.GetWithMeta("a")
+		testutils.Assert(t, found, "key a not found")
+		testutils.Assert(t, meta.Version == 4, "expected version 4, but got %d", meta.Version)
+		testutils.Assert(t, meta.Sequence == 5, "expected sequence 5, but got %d", meta.Sequence)
+		testutils.Assert(t, !meta.Timestamp.Before(before), "timestamp %v is before %v", meta.Timestamp, before)
+
+		mt.Delete(context.Background(), "b")
+		mt.Set(context.Background(), "b", "new")
+		_, meta, _ = mt.GetWithMeta("b")
+		testutils.Assert(t, meta.Version == 1, "expected version 1 after recreation, but got %d", meta.Version)
+		testutils.Assert(t, meta.Sequence == 7, "expected sequence 7, but got %d", meta.Sequence)
+
+		_, expected, _ := mt.GetWithMeta("a")
+		mt.compact()
+		mt.Close()
+
+		reopend, err := CreateMemtable[string, string]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		_, meta, _ = reopend.GetWithMeta("a")
+		testutils.Assert(t, meta.Version == expected.Version, "expected version %d, but got %d", expected.Version, meta.Version)
+		testutils.Assert(t, meta.Sequence == expected.Sequence, "expected sequence %d, but got %d", expected.Sequence, meta.Sequence)
+		testutils.Assert(t, meta.Timestamp.Equal(expected.Timestamp), "expected timestamp %v, but got %v", expected.Timestamp, meta.Timestamp)
+
+		reopend.Set(context.Background(), "c", "1")
+		_, meta, _ = reopend.GetWithMeta("c")
+		testutils.Assert(t, meta.Sequence == 8, "expected sequence to continue with 8, but got %d", meta.Sequence)
+		// a new key does not take over the version of its successor
+		reopend.Set(context.Background(), "0", "1")
+		_, meta, _ = reopend.GetWithMeta("0")
+		testutils.Assert(t, meta.Version == 1, "expected version 1 of a new key, but got %d", meta.Version)
+		reopend.Close()
+	})
+}
+
+func TestSequence_Compaction(t *testing.T) {
+	testutils.RunWithTempDir("TestSequence_Compaction", func(dir string) {
+		mt, err := CreateMemtable[string, string]("testmt", WithDatadir(dir), WithDisableAutoCompaction())
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), "a", "1")
+		mt.Set(context.Background(), "b", "1")
+		mt.Set(context.Background(), "b", "2")
+		mt.Delete(context.Background(), "b")
+		testutils.AssertNoError(t, mt.compact(), "Fehler beim kompaktieren")
+		mt.Close()
+
+		// the sequences of the removed records of b are not assigned again
+		reopend, err := CreateMemtable[string, string]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		reopend.Set(context.Background(), "c", "1")
+		_, meta, _ := reopend.GetWithMeta("c")
+		testutils.Assert(t, meta.Sequence == 5, "expected sequence 5, but got %d", meta.Sequence)
+		reopend.Close()
+	})
+}
+
+func TestLogRecovery(t *testing.T) {
+	testutils.RunWithTempDir("TestLogRecovery", func(dir string) {
+		mt, err := CreateMemtable[int, string]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), 1, "eins")
+		mt.Set(context.Background(), 2, "zwei")
+		filename := mt.log.GetFilename()
+		mt.Close()
+
+		stat, _ := os.Stat(filename)
+		os.Truncate(filename, stat.Size()-1)
+
+		_, err = CreateMemtable[int, string]("testmt", WithDatadir(dir))
+		testutils.Assert(t, err != nil, "expected error for torn log tail")
+
+		recovered, err := CreateMemtable[int, string]("testmt", WithDatadir(dir), WithLogRecovery())
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable im recovery mode")
+		testutils.Assert(t, recovered.Size() == 1, "expected 1 recovered entry, but got %d", recovered.Size())
+		recovered.Close()
+	})
+}
+
+func TestDurability(t *testing.T) {
+	testutils.RunWithTempDir("TestDurability", func(dir string) {
+		mt, err := CreateMemtable[int, string]("testmt", WithDatadir(dir), WithDurability(messagelog.SyncAlways()), WithCompactThreshold(2))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		for i := 0; i < 10; i++ {
+			_, err = mt.Set(context.Background(), i%3, "x")
+			testutils.AssertNoError(t, err, "Fehler beim schreiben")
+		}
+		mt.Close()
+
+		reopend, err := CreateMemtable[int, string]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		testutils.Assert(t, reopend.Size() == 3, "expected 3 entries, but got %d", reopend.Size())
+		reopend.Close()
+	})
+}
+
+func TestGroupCommit(t *testing.T) {
+	testutils.RunWithTempDir("TestGroupCommit", func(dir string) {
+		mt, err := CreateMemtable[int, int]("testmt", WithDatadir(dir), WithDurability(messagelog.SyncAlways()), WithDisableAutoCompaction())
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		events, _ := mt.Watch(context.Background(), WatchAll[int](), WithBufferSize(1000))
+
+		wg := sync.WaitGroup{}
+		for w := 0; w < 8; w++ {
+			wg.Add(1)
+			go func(offset int) {
+				defer wg.Done()
+				for i := 0; i < 25; i++ {
+					_, err := mt.Set(context.Background(), offset*100+i, i)
+					testutils.AssertNoError(t, err, "Fehler beim schreiben")
+				}
+			}(w)
+		}
+		wg.Wait()
+
+		stats := mt.log.Stats()
+		testutils.Assert(t, stats.Records == 200, "expected 200 records, but got %d", stats.Records)
+		var sequence uint64
+		for i := 0; i < 200; i++ {
+			event := <-events
+			testutils.Assert(t, event.Sequence > sequence, "event %d out of order", event.Sequence)
+			sequence = event.Sequence
+		}
+		mt.Close()
+
+		reopend, err := CreateMemtable[int, int]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		testutils.Assert(t, reopend.Size() == 200, "expected 200 entries, but got %d", reopend.Size())
+		reopend.Close()
+	})
+}
+
+func TestFailedLogWrite(t *testing.T) {
+	testutils.RunWithTempDir("TestFailedLogWrite", func(dir string) {
+		options := []ConfigOption{
+			WithDatadir(dir),
+			WithSegmentRecords(2),
+			WithDisableAutoCompaction(),
+			WithIndex[int]("byName", func(name string) []string { return []string{name} }),
+		}
+		mt, err := CreateMemtable[int, string]("testmt", options...)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), 1, "eins")
+		mt.Set(context.Background(), 2, "zwei")
+
+		// the next segment can't be created, so the next record fails
+		first := mt.log.Segments()[0].Filename
+		next := strings.TrimSuffix(first, fmt.Sprintf("%020d", 0)) + fmt.Sprintf("%020d", 2)
+		os.Mkdir(next, 0755)
+		err = mt.Apply(context.Background(), NewWriteBatch[int, string]().Put(1, "EINS").Delete(2).Put(3, "drei").Put(1, "one"))
+		testutils.Assert(t, err != nil, "expected failed write")
+		value, _ := mt.Get(1)
+		testutils.Assert(t, value == "eins", "expected eins, but got %s", value)
+		value, _ = mt.Get(2)
+		testutils.Assert(t, value == "zwei", "expected zwei, but got %s", value)
+		_, found := mt.Get(3)
+		testutils.Assert(t, !found, "failed write is visible")
+		entries, _ := mt.QueryIndex("byName", "eins")
+		testutils.Assert(t, len(entries) == 1, "expected eins in the index, but got %v", entries)
+		entries, _ = mt.QueryIndex("byName", "one")
+		testutils.Assert(t, len(entries) == 0, "failed write is indexed: %v", entries)
+
+		os.Remove(next)
+		_, err = mt.Set(context.Background(), 3, "drei")
+		testutils.AssertNoError(t, err, "Fehler beim schreiben nach fehlgeschlagenem schreiben")
+		mt.Close()
+
+		reopend, err := CreateMemtable[int, string]("testmt", options...)
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		testutils.Assert(t, reopend.Size() == 3, "expected 3 entries, but got %d", reopend.Size())
+		value, _ = reopend.Get(1)
+		testutils.Assert(t, value == "eins", "expected eins, but got %s", value)
+		reopend.Close()
+	})
+}
+
+func TestQueuedWrite(t *testing.T) {
+	testutils.RunWithTempDir("TestQueuedWrite", func(dir string) {
+		mt, err := CreateMemtable[int, string]("testmt", WithDatadir(dir), WithDisableAutoCompaction())
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		defer mt.Close()
+
+		// the record is written by the first Wait, until then it is only visible to writers
+		mt.mutex.Lock()
+		pending, err := mt.writeLocked(context.Background(), mutation[int, string]{Type: write, Key: 1, Value: "eins"})
+		mt.mutex.Unlock()
+		testutils.AssertNoError(t, err, "Fehler beim einreihen")
+		_, found := mt.Get(1)
+		testutils.Assert(t, !found, "queued write is visible")
+		written, err := mt.SetIfAbsent(context.Background(), 1, "uno")
+		testutils.AssertNoError(t, err, "Fehler beim schreiben")
+		testutils.Assert(t, !written, "queued write has been overwritten")
+
+		testutils.AssertNoError(t, pending.Wait(), "Fehler beim schreiben")
+		mt.mutex.Lock()
+		mt.applyWrittenLocked()
+		mt.mutex.Unlock()
+		value, found := mt.Get(1)
+		testutils.Assert(t, found && value == "eins", "expected eins, but got %s", value)
+	})
+}
+
+func TestFailedCompaction(t *testing.T) {
+	testutils.RunWithTempDir("TestFailedCompaction", func(dir string) {
+		mt, err := CreateMemtable[int, int]("testmt", WithDatadir(dir), WithDisableAutoCompaction())
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		for i := 0; i < 20; i++ {
+			mt.Set(context.Background(), i, i)
+		}
+
+		// a damaged file in place of the new log, which is removed after the failed compaction
+		os.WriteFile(mt.frs.Filename(1), []byte("incomplete"), 0644)
+		testutils.Assert(t, mt.compact() != nil, "expected failed compaction")
+		_, err = os.Stat(mt.frs.Filename(1))
+		testutils.Assert(t, os.IsNotExist(err), "log of the failed compaction has not been removed")
+		_, err = mt.Set(context.Background(), 20, 20)
+		testutils.AssertNoError(t, err, "Fehler beim schreiben nach fehlgeschlagener kompaktierung")
+		mt.Close()
+	})
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"github.com/mwildt/goodb/codecs"
 	"github.com/mwildt/goodb/messagelog"
+	"github.com/mwildt/goodb/sstable"
 	"golang.org/x/exp/constraints"
 	"log"
+	"os"
 	"path"
+	"slices"
 	"time"
 )
 
@@ -34,6 +37,9 @@ type MigrationManager[K constraints.Ordered, M any] struct {
 	migrationLog   *messagelog.MessageLog[migrationLogMessage]
 	migrations     []Migration[M]
 	codec          codecs.Codec[M]
+	logOptions     []messagelog.Option // options for the migrated memtable logs
+	tableOptions   []sstable.Option    // options for the migrated tables
+	manifest       *manifest           // opened by migrate if not set
 }
 
 func NewMigrationManager[K constraints.Ordered, M any](
@@ -53,6 +59,9 @@ func NewMigrationManager[K constraints.Ordered, M any](
 			migrationLog:   migrationLog,
 			migrations:     migrations,
 			codec:          codec,
+			logOptions: []messagelog.Option{
+				messagelog.WithCodec[memtableMessage[K, []byte]](newMessageCodec[K](defaultRecordFormat(), codec)),
+			},
 		}
 
 		return manager, manager.init()
@@ -88,35 +97,47 @@ func (manager *MigrationManager[K, M]) migrate(ctx context.Context) error {
 	}
 
 	if len(migrationsToApply) > 0 {
+		if manager.manifest == nil {
+			var err error
+			if manager.manifest, err = openManifest(manager.frs); err != nil {
+				return err
+			}
+			defer func() {
+				manager.manifest.close()
+				manager.manifest = nil
+			}()
+		}
 		sourceFile := manager.frs.CurrentFilename()
 		targetFile := manager.frs.NextFilename()
 		execTime := time.Now()
 
-		if source, err := messagelog.NewMessageLog[memtableMessage[K, []byte]](sourceFile); err != nil {
+		if source, err := messagelog.NewMessageLog[memtableMessage[K, []byte]](sourceFile, manager.logOptions...); err != nil {
 			return err
-		} else if target, err := messagelog.NewMessageLog[memtableMessage[K, []byte]](targetFile); err != nil {
+		} else if target, err := messagelog.NewMessageLog[memtableMessage[K, []byte]](targetFile, manager.logOptions...); err != nil {
 			return err
 		} else {
 
 			count, err := source.Open(func(ctx context.Context, message memtableMessage[K, []byte]) error {
-				// decoding
-				migrationObject, err := manager.codec.Decode(message.Value)
-				if err != nil {
+				if migrated, err := manager.migrateMessage(message, migrationsToApply); err != nil {
 					return err
+				} else {
+					return target.Append(ctx, migrated)
 				}
-				for _, migration := range migrationsToApply {
-					if migrationObject, err = migration.Handler(migrationObject); err != nil {
-						return err
-					}
-				}
-				// re encoding
-				message.Value, err = manager.codec.Encode(migrationObject)
-				return target.Append(ctx, message)
 			})
 
 			if err != nil {
 				return nil
 			}
+			source.Close()
+			if err = target.Close(); err != nil {
+				return err
+			} else if err = manager.manifest.apply([]string{targetFile}, []string{sourceFile}); err != nil {
+				return err
+			}
+			source.Delete()
+			if err = manager.migrateTables(); err != nil {
+				return err
+			}
 			log.Printf("[migrationmanager] all %d migrations have been applied. %d items have been migrated.\n", len(migrationsToApply), count)
 			for _, migration := range migrationsToApply {
 				log.Printf("[migrationmanager] migration (name %s, version: %s) has been executed successfully. Append to log.\n", migration.Name, migration.Version)
@@ -129,3 +150,102 @@ func (manager *MigrationManager[K, M]) migrate(ctx context.Context) error {
 	}
 	return nil
 }
+
+// migrateTables rewrites the tables of the collection which have not been migrated completely. Each table records
+// the number of migrations applied to its values, so the migration of the tables continues after an interruption.
+// The rewritten tables get new numbers in the order of the original tables and replace them in the manifest.
+func (manager *MigrationManager[K, M]) migrateTables() error {
+	numbers := manager.manifest.tables(manager.collectionName)
+	if len(numbers) == 0 {
+		return nil
+	}
+	next := numbers[len(numbers)-1]
+	for _, n := range numbers {
+		filename := tableFilename(manager.frs.basedir, manager.collectionName, n)
+		table, err := sstable.Open[K](filename, manager.tableOptions...)
+		if err != nil {
+			return err
+		}
+		meta, err := decodeTableMetadata(table.Metadata())
+		if err != nil || meta.migrations >= len(manager.migrations) {
+			table.Close()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		next++
+		target := tableFilename(manager.frs.basedir, manager.collectionName, next)
+		err = manager.migrateTable(table, target, meta)
+		table.Close()
+		if err == nil {
+			err = manager.manifest.apply([]string{target}, []string{filename})
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("[migrationmanager] table %s has been migrated.\n", filename)
+		os.Remove(filename)
+	}
+	return nil
+}
+
+func (manager *MigrationManager[K, M]) migrateTable(table *sstable.Table[K], filename string, meta tableMetadata) error {
+	migrations := manager.migrations[meta.migrations:]
+	meta.migrations = len(manager.migrations)
+	writer, err := sstable.NewWriter[K](filename, append(slices.Clone(manager.tableOptions), sstable.WithMetadata(meta.encode()))...)
+	if err != nil {
+		return err
+	}
+	for entry, err := range table.All() {
+		message := memtableMessage[K, []byte]{}
+		if err == nil {
+			err = message.UnmarshalBinary(entry.Value)
+		}
+		if err == nil {
+			message, err = manager.migrateMessage(message, migrations)
+		}
+		var data []byte
+		if err == nil {
+			data, err = message.MarshalBinary()
+		}
+		if err == nil {
+			err = writer.Add(entry.Key, data)
+		}
+		if err != nil {
+			writer.Abort()
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+// migrateMessage applies the migrations to the value of a write message or to each write of a batch message
+func (manager *MigrationManager[K, M]) migrateMessage(message memtableMessage[K, []byte], migrations []Migration[M]) (memtableMessage[K, []byte], error) {
+	switch message.Type {
+	case write:
+		// decoding
+		migrationObject, err := manager.codec.Decode(message.Value)
+		if err != nil {
+			return message, err
+		}
+		for _, migration := range migrations {
+			if migrationObject, err = migration.Handler(migrationObject); err != nil {
+				return message, err
+			}
+		}
+		// re encoding
+		message.Value, err = manager.codec.Encode(migrationObject)
+		return message, err
+	case batch:
+		nested := make([]memtableMessage[K, []byte], len(message.Batch))
+		for i, m := range message.Batch {
+			var err error
+			if nested[i], err = manager.migrateMessage(m, migrations); err != nil {
+				return message, err
+			}
+		}
+		message.Batch = nested
+	}
+	return message, nil
+}
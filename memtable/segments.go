@@ -0,0 +1,95 @@
+package memtable
+
+import (
+	"context"
+	"github.com/mwildt/goodb/messagelog"
+	"slices"
+	"time"
+)
+
+// compactSegmentsLocked removes the oldest segments of a segmented log instead of rewriting the whole log. The
+// longest prefix of segments, which contains at least as many obsolete as live records, is removed after its live
+// records have been copied to the active segment. A mostly live segment is removed together with the obsolete
+// segments following it. Only a prefix of the segments is removed, so deletes are never dropped before the writes
+// they delete. The caller must hold mt.mutex.
+func (mt *Memtable[K, V]) compactSegmentsLocked() error {
+	mt.settleLocked()
+	segments := mt.log.Segments()
+	closed := segments[:len(segments)-1]
+	now := time.Now()
+	live := make([]int, len(closed))
+	for _, rec := range mt.index.All() {
+		if i := segmentOf(closed, rec.position); i >= 0 && !rec.expired(now) {
+			live[i]++
+		}
+	}
+	count, liveRecords, records := 0, 0, 0
+	for i, seg := range closed {
+		liveRecords, records = liveRecords+live[i], records+seg.Records
+		if liveRecords*2 <= records {
+			count = i + 1
+		}
+	}
+	if count == 0 {
+		mt.segmentCount = len(segments)
+		return nil
+	}
+	limit := closed[count-1].BaseOffset + closed[count-1].Records
+
+	keys := make([]K, 0)
+	pendings := make([]*messagelog.Pending, 0)
+	var err error
+	for key, rec := range mt.index.All() {
+		m := mutation[K, V]{Type: write, Key: key, Value: rec.value, Meta: rec.meta}
+		if rec.tombstone {
+			m = mutation[K, V]{Type: delete, Key: key, Meta: rec.meta}
+		}
+		var message memtableMessage[K, []byte]
+		var pending *messagelog.Pending
+		if rec.position >= limit || rec.expired(now) {
+			continue
+		} else if message, err = mt.encode([]mutation[K, V]{m}); err != nil {
+			break
+		} else if pending, err = mt.log.Enqueue(context.Background(), message); err != nil {
+			break
+		}
+		keys = append(keys, key)
+		pendings = append(pendings, pending)
+	}
+	for _, pending := range pendings {
+		if waitErr := pending.Wait(); err == nil {
+			err = waitErr
+		}
+	}
+	if err != nil {
+		// all copies have been written or failed, so the log can accept records again
+		mt.log.Resume()
+		return err
+	}
+	// the copies are referenced once they have been written, a failed copy leaves the segments in use
+	for i, key := range keys {
+		rec, _ := mt.index.Get(key)
+		rec.position = pendings[i].Offset()
+		mt.index.Set(key, rec)
+	}
+	if err := mt.log.Sync(); err != nil {
+		return err
+	}
+	_, err = mt.log.DeleteSegmentsBefore(limit)
+	mt.segmentCount = len(mt.log.Segments())
+	return err
+}
+
+// segmentOf returns the index of the segment containing the record at position or -1
+func segmentOf(segments []messagelog.SegmentInfo, position int) int {
+	i, found := slices.BinarySearchFunc(segments, position, func(seg messagelog.SegmentInfo, position int) int {
+		return seg.BaseOffset - position
+	})
+	if !found {
+		i--
+	}
+	if i < 0 || i >= len(segments) || position >= segments[i].BaseOffset+segments[i].Records {
+		return -1
+	}
+	return i
+}
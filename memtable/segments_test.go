@@ -0,0 +1,86 @@
+package memtable
+
+import (
+	"context"
+	"github.com/mwildt/goodb/utils/testutils"
+	"testing"
+)
+
+func TestSegmentedCompaction(t *testing.T) {
+	testutils.RunWithTempDir("TestSegmentedCompaction", func(dir string) {
+		mt, err := CreateMemtable[int, int]("testmt", WithDatadir(dir), WithSegmentRecords(10), WithDisableAutoCompaction())
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), 1000, 1)
+		mt.Set(context.Background(), 2000, 2)
+		mt.Delete(context.Background(), 2000)
+		for i := 0; i < 50; i++ {
+			mt.Set(context.Background(), i%5, i)
+		}
+		testutils.Assert(t, len(mt.log.Segments()) == 6, "expected 6 segments, but got %d", len(mt.log.Segments()))
+
+		testutils.AssertNoError(t, mt.compact(), "Fehler beim kompaktieren")
+		segments := mt.log.Segments()
+		testutils.Assert(t, len(segments) == 1, "expected 1 segment, but got %d", len(segments))
+		testutils.Assert(t, mt.log.MessageCount() == 6, "expected 6 records, but got %d", mt.log.MessageCount())
+		mt.Close()
+
+		reopend, err := CreateMemtable[int, int]("testmt", WithDatadir(dir), WithSegmentRecords(10))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		testutils.Assert(t, reopend.Size() == 6, "expected 6 entries, but got %d", reopend.Size())
+		value, _ := reopend.Get(1000)
+		testutils.Assert(t, value == 1, "expected 1, but got %d", value)
+		value, _ = reopend.Get(4)
+		testutils.Assert(t, value == 49, "expected 49, but got %d", value)
+		_, found := reopend.Get(2000)
+		testutils.Assert(t, !found, "deleted key has been restored")
+		reopend.Close()
+	})
+}
+
+func TestSegmentedAutoCompaction(t *testing.T) {
+	testutils.RunWithTempDir("TestSegmentedAutoCompaction", func(dir string) {
+		mt, err := CreateMemtable[int, int]("testmt", WithDatadir(dir), WithSegmentRecords(10))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		for i := 0; i < 200; i++ {
+			mt.Set(context.Background(), i%3, i)
+		}
+		mt.compact()
+		testutils.Assert(t, len(mt.log.Segments()) <= 2, "expected old segments to be removed, but got %d", len(mt.log.Segments()))
+		mt.Close()
+
+		reopend, err := CreateMemtable[int, int]("testmt", WithDatadir(dir), WithSegmentRecords(10))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		testutils.Assert(t, reopend.Size() == 3, "expected 3 entries, but got %d", reopend.Size())
+		value, _ := reopend.Get(1)
+		testutils.Assert(t, value == 199, "expected 199, but got %d", value)
+		reopend.Close()
+	})
+}
+
+func TestSegmentedCompaction_ColdPrefix(t *testing.T) {
+	testutils.RunWithTempDir("TestSegmentedCompaction_ColdPrefix", func(dir string) {
+		mt, err := CreateMemtable[int, int]("testmt", WithDatadir(dir), WithSegmentRecords(100), WithDisableAutoCompaction())
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		for i := 0; i < 100; i++ {
+			mt.Set(context.Background(), i, i)
+		}
+		for i := 0; i < 5000; i++ {
+			mt.Set(context.Background(), 1000, i)
+		}
+
+		// the live first segment is removed together with the obsolete segments of the hot key
+		testutils.AssertNoError(t, mt.compact(), "Fehler beim kompaktieren")
+		segments := mt.log.Segments()
+		testutils.Assert(t, len(segments) <= 3, "expected at most 3 segments, but got %d", len(segments))
+		mt.Close()
+
+		reopend, err := CreateMemtable[int, int]("testmt", WithDatadir(dir), WithSegmentRecords(100))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		testutils.Assert(t, reopend.Size() == 101, "expected 101 entries, but got %d", reopend.Size())
+		value, _ := reopend.Get(42)
+		testutils.Assert(t, value == 42, "expected 42, but got %d", value)
+		value, _ = reopend.Get(1000)
+		testutils.Assert(t, value == 4999, "expected 4999, but got %d", value)
+		reopend.Close()
+	})
+}
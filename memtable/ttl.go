@@ -0,0 +1,53 @@
+package memtable
+
+import (
+	"context"
+	"time"
+)
+
+func (rec record[V]) expired(now time.Time) bool {
+	return !rec.meta.ExpiresAt.IsZero() && !now.Before(rec.meta.ExpiresAt)
+}
+
+// SetWithTTL writes the key value pair, which expires after ttl. Expired keys are invisible immediately and
+// removed from the index by a background reaper.
+func (mt *Memtable[K, V]) SetWithTTL(ctx context.Context, key K, value V, ttl time.Duration) (V, error) {
+	return value, mt.write(ctx, func() ([]mutation[K, V], error) {
+		return []mutation[K, V]{{Type: write, Key: key, Value: value, TTL: ttl}}, nil
+	})
+}
+
+// reapExpired periodically removes expired keys from the index until the memtable is closed. The removal is not
+// logged: expired writes are skipped on replay and dropped on compaction.
+func (mt *Memtable[K, V]) reapExpired(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-mt.stop:
+			return
+		case <-ticker.C:
+			mt.reapExpiredOnce()
+		}
+	}
+}
+
+func (mt *Memtable[K, V]) reapExpiredOnce() (count int) {
+	defer mt.awaitDelivery(context.Background())
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+	now := time.Now()
+	events := make([]ChangeEvent[K, V], 0)
+	for key, rec := range mt.index.All() {
+		if !rec.tombstone && rec.expired(now) {
+			mt.removeFromIndex(key, rec.meta, rec.position)
+			for _, idx := range mt.indexes {
+				idx.remove(key, rec.value)
+			}
+			events = append(events, ChangeEvent[K, V]{Operation: OperationExpire, Key: key, OldValue: rec.value, Existed: true, Sequence: rec.meta.Sequence})
+			count++
+		}
+	}
+	mt.publishLocked(events)
+	return count
+}
@@ -0,0 +1,57 @@
+package memtable
+
+import (
+	"context"
+	"github.com/mwildt/goodb/base"
+	"github.com/mwildt/goodb/utils/testutils"
+	"testing"
+	"time"
+)
+
+func TestSetWithTTL(t *testing.T) {
+	testutils.RunWithTempDir("TestSetWithTTL", func(dir string) {
+		mt, err := CreateMemtable[string, string]("testmt", WithDatadir(dir), WithReaperInterval(10*time.Millisecond))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.SetWithTTL(context.Background(), "session", "data", 50*time.Millisecond)
+		mt.Set(context.Background(), "permanent", "data")
+
+		_, meta, found := mt.GetWithMeta("session")
+		testutils.Assert(t, found, "session not found before expiry")
+		testutils.Assert(t, !meta.ExpiresAt.IsZero(), "session has no expiry")
+
+		time.Sleep(60 * time.Millisecond)
+		_, found = mt.Get("session")
+		testutils.Assert(t, !found, "session found after expiry")
+		entries := mt.Range("a", "z", base.RangeOptions{})
+		testutils.Assert(t, len(entries) == 1, "expected only permanent key in range, but got %d", len(entries))
+		testutils.Assert(t, mt.Size() == 1, "expired key is counted, size is %d", mt.Size())
+
+		time.Sleep(30 * time.Millisecond)
+		testutils.Assert(t, mt.Size() == 1, "expired key was not reaped, size is %d", mt.Size())
+
+		mt.compact()
+		// the permanent key and the record of the last sequence
+		testutils.Assert(t, mt.log.MessageCount() == 2, "expected 2 messages after compaction, but got %d", mt.log.MessageCount())
+		mt.Close()
+	})
+}
+
+func TestDefaultTTL(t *testing.T) {
+	testutils.RunWithTempDir("TestDefaultTTL", func(dir string) {
+		mt, err := CreateMemtable[int, string]("testmt", WithDatadir(dir), WithDefaultTTL(20*time.Millisecond))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), 1, "eins")
+		mt.SetWithTTL(context.Background(), 2, "zwei", time.Hour)
+		mt.Close()
+
+		time.Sleep(30 * time.Millisecond)
+		reopend, err := CreateMemtable[int, string]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		_, found := reopend.Get(1)
+		testutils.Assert(t, !found, "expired key 1 was restored")
+		_, found = reopend.Get(2)
+		testutils.Assert(t, found, "key 2 with long ttl was not restored")
+		testutils.Assert(t, reopend.Size() == 1, "expected size 1, but got %d", reopend.Size())
+		reopend.Close()
+	})
+}
@@ -0,0 +1,97 @@
+package memtable
+
+import (
+	"context"
+	"errors"
+	"golang.org/x/exp/constraints"
+)
+
+var (
+	// ErrConflict is returned by Txn.Commit if a key read by the transaction was changed concurrently
+	ErrConflict = errors.New("transaction conflict")
+	// ErrTxnDone is returned when a committed or rolled back transaction is used
+	ErrTxnDone = errors.New("transaction already committed or rolled back")
+)
+
+// Txn is an optimistic read-modify-write transaction on a Memtable. Writes are buffered until Commit, which
+// fails with ErrConflict if any key read by the transaction has been changed in the meantime.
+// A Txn must not be used by multiple goroutines at the same time.
+type Txn[K constraints.Ordered, V any] struct {
+	memtable *Memtable[K, V]
+	reads    map[K]uint64 // sequence of the record seen by the first read, 0 if absent
+	writes   *WriteBatch[K, V]
+	pending  map[K]mutation[K, V] // latest buffered mutation per key
+	done     bool
+}
+
+// Begin starts a new transaction
+func (mt *Memtable[K, V]) Begin() *Txn[K, V] {
+	return &Txn[K, V]{
+		memtable: mt,
+		reads:    make(map[K]uint64),
+		writes:   NewWriteBatch[K, V](),
+		pending:  make(map[K]mutation[K, V]),
+	}
+}
+
+// Get returns the value of key as seen by the transaction, including its own uncommitted writes
+func (txn *Txn[K, V]) Get(key K) (value V, found bool, err error) {
+	if txn.done {
+		return value, false, ErrTxnDone
+	}
+	if m, buffered := txn.pending[key]; buffered {
+		return m.Value, m.Type == write, nil
+	}
+	rec, found, err := txn.memtable.lookup(key)
+	if err != nil {
+		return value, false, err
+	}
+	if _, seen := txn.reads[key]; !seen {
+		txn.reads[key] = rec.meta.Sequence
+	}
+	return rec.value, found, nil
+}
+
+// Set buffers a write of the key value pair
+func (txn *Txn[K, V]) Set(key K, value V) error {
+	if txn.done {
+		return ErrTxnDone
+	}
+	txn.writes.Put(key, value)
+	txn.pending[key] = mutation[K, V]{Type: write, Key: key, Value: value}
+	return nil
+}
+
+// Delete buffers the removal of key
+func (txn *Txn[K, V]) Delete(key K) error {
+	if txn.done {
+		return ErrTxnDone
+	}
+	txn.writes.Delete(key)
+	txn.pending[key] = mutation[K, V]{Type: delete, Key: key}
+	return nil
+}
+
+// Commit validates the read set and writes all buffered mutations as one atomic log record
+func (txn *Txn[K, V]) Commit(ctx context.Context) error {
+	if txn.done {
+		return ErrTxnDone
+	}
+	txn.done = true
+	mt := txn.memtable
+	return mt.write(ctx, func() ([]mutation[K, V], error) {
+		for key, sequence := range txn.reads {
+			if rec, _, err := mt.lookupLocked(key); err != nil {
+				return nil, err
+			} else if rec.meta.Sequence != sequence {
+				return nil, ErrConflict
+			}
+		}
+		return txn.writes.mutations, nil
+	})
+}
+
+// Rollback discards all buffered mutations
+func (txn *Txn[K, V]) Rollback() {
+	txn.done = true
+}
@@ -0,0 +1,82 @@
+package memtable
+
+import (
+	"context"
+	"errors"
+	"github.com/mwildt/goodb/utils/testutils"
+	"testing"
+)
+
+func TestTxn_Commit(t *testing.T) {
+	testutils.RunWithTempDir("TestTxn_Commit", func(dir string) {
+		mt, err := CreateMemtable[string, int]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), "a", 100)
+		mt.Set(context.Background(), "b", 0)
+
+		txn := mt.Begin()
+		a, _, _ := txn.Get("a")
+		b, _, _ := txn.Get("b")
+		txn.Set("a", a-30)
+		txn.Set("b", b+30)
+		txn.Delete("c")
+		value, found, _ := txn.Get("a")
+		testutils.Assert(t, found && value == 70, "expected own write 70, but got %d", value)
+		_, found, _ = txn.Get("c")
+		testutils.Assert(t, !found, "own delete of c not visible")
+
+		value, _ = mt.Get("a")
+		testutils.Assert(t, value == 100, "uncommitted write visible, got %d", value)
+
+		err = txn.Commit(context.Background())
+		testutils.AssertNoError(t, err, "Fehler beim commit")
+		value, _ = mt.Get("b")
+		testutils.Assert(t, value == 30, "expected committed value 30, but got %d", value)
+
+		err = txn.Commit(context.Background())
+		testutils.Assert(t, errors.Is(err, ErrTxnDone), "expected ErrTxnDone, but got %v", err)
+		mt.Close()
+
+		reopend, err := CreateMemtable[string, int]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		value, _ = reopend.Get("a")
+		testutils.Assert(t, value == 70, "expected persisted value 70, but got %d", value)
+		reopend.Close()
+	})
+}
+
+func TestTxn_Conflict(t *testing.T) {
+	testutils.RunWithTempDir("TestTxn_Conflict", func(dir string) {
+		mt, err := CreateMemtable[string, int]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		mt.Set(context.Background(), "counter", 1)
+
+		first := mt.Begin()
+		second := mt.Begin()
+		v1, _, _ := first.Get("counter")
+		v2, _, _ := second.Get("counter")
+		first.Set("counter", v1+1)
+		second.Set("counter", v2+1)
+
+		testutils.AssertNoError(t, first.Commit(context.Background()), "Fehler beim ersten commit")
+		err = second.Commit(context.Background())
+		testutils.Assert(t, errors.Is(err, ErrConflict), "expected ErrConflict, but got %v", err)
+
+		value, _ := mt.Get("counter")
+		testutils.Assert(t, value == 2, "expected counter 2, but got %d", value)
+
+		absent := mt.Begin()
+		absent.Get("new")
+		mt.Set(context.Background(), "new", 1)
+		absent.Set("new", 5)
+		err = absent.Commit(context.Background())
+		testutils.Assert(t, errors.Is(err, ErrConflict), "expected ErrConflict for concurrently created key, but got %v", err)
+
+		rolledBack := mt.Begin()
+		rolledBack.Set("counter", 99)
+		rolledBack.Rollback()
+		value, _ = mt.Get("counter")
+		testutils.Assert(t, value == 2, "rollback has been applied, counter is %d", value)
+		mt.Close()
+	})
+}
@@ -0,0 +1,292 @@
+package memtable
+
+import (
+	"context"
+	"github.com/mwildt/goodb/messagelog"
+	"golang.org/x/exp/constraints"
+	"slices"
+)
+
+type Operation int8
+
+const (
+	OperationSet    Operation = 1
+	OperationDelete Operation = 2
+	OperationExpire Operation = 3
+)
+
+// ChangeEvent describes a single change of a key
+type ChangeEvent[K constraints.Ordered, V any] struct {
+	Operation Operation
+	Key       K
+	OldValue  V    // value before the change, zero if the key did not exist
+	NewValue  V    // value after the change, zero for deletes and expiry
+	Existed   bool // true if the key had a value before the change
+	Sequence  uint64
+}
+
+// WatchFilter selects the keys a watch receives events for
+type WatchFilter[K constraints.Ordered] struct {
+	from, to K
+	all      bool
+}
+
+// WatchKey selects a single key
+func WatchKey[K constraints.Ordered](key K) WatchFilter[K] {
+	return WatchFilter[K]{from: key, to: key}
+}
+
+// WatchRange selects all keys between from and to (inclusive)
+func WatchRange[K constraints.Ordered](from, to K) WatchFilter[K] {
+	return WatchFilter[K]{from: from, to: to}
+}
+
+// WatchAll selects the whole collection
+func WatchAll[K constraints.Ordered]() WatchFilter[K] {
+	return WatchFilter[K]{all: true}
+}
+
+func (filter WatchFilter[K]) matches(key K) bool {
+	return filter.all || (filter.from <= key && key <= filter.to)
+}
+
+// SlowConsumerPolicy defines what happens if the buffer of a watch is full
+type SlowConsumerPolicy int8
+
+const (
+	// DisconnectSlowConsumer closes the event channel of the watch
+	DisconnectSlowConsumer SlowConsumerPolicy = iota
+	// DropEventsForSlowConsumer discards events which do not fit into the buffer
+	DropEventsForSlowConsumer
+	// BlockOnSlowConsumer makes writers, compactions and the expiry of keys wait until the consumer has received all
+	// events queued so far or its context is done, which bounds the queue of the watch. The events are delivered
+	// outside of the memtable's lock, so a stalled consumer blocks neither Close nor the writes of other goroutines
+	// from being applied.
+	BlockOnSlowConsumer
+)
+
+type watchConfiguration struct {
+	bufferSize int
+	policy     SlowConsumerPolicy
+}
+
+type WatchOption func(*watchConfiguration)
+
+// WithBufferSize sets the number of events buffered for a watch, the default is 64
+func WithBufferSize(size int) WatchOption {
+	return func(c *watchConfiguration) {
+		c.bufferSize = size
+	}
+}
+
+// WithSlowConsumerPolicy sets the handling of full buffers, the default is DisconnectSlowConsumer
+func WithSlowConsumerPolicy(policy SlowConsumerPolicy) WatchOption {
+	return func(c *watchConfiguration) {
+		c.policy = policy
+	}
+}
+
+// outboxEntry holds the mutations of a queued log record and the records they replace until the record has been
+// written
+type outboxEntry[K constraints.Ordered, V any] struct {
+	pending   *messagelog.Pending
+	mutations []mutation[K, V]
+	replaced  []replaced[V]
+}
+
+type watcher[K constraints.Ordered, V any] struct {
+	ctx    context.Context
+	filter WatchFilter[K]
+	policy SlowConsumerPolicy
+	events chan ChangeEvent[K, V]
+	done   chan struct{}
+	// delivery of BlockOnSlowConsumer watchers, guarded by mt.mutex
+	queue    []ChangeEvent[K, V]
+	queued   int           // number of events added to queue
+	sent     int           // number of events sent to the channel
+	wake     chan struct{} // signals new events in queue
+	progress chan struct{} // closed and replaced after each sent event
+}
+
+// Watch returns a channel receiving an event for every change of a key selected by filter. Events are
+// delivered in log order after the change has been written to the log. The channel is closed when ctx is done, the
+// memtable is closed or the consumer has been disconnected by the slow consumer policy.
+func (mt *Memtable[K, V]) Watch(ctx context.Context, filter WatchFilter[K], options ...WatchOption) (<-chan ChangeEvent[K, V], error) {
+	config := watchConfiguration{bufferSize: 64, policy: DisconnectSlowConsumer}
+	for _, opt := range options {
+		opt(&config)
+	}
+
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+	if mt.closed {
+		return nil, ErrClosed
+	}
+	w := &watcher[K, V]{
+		ctx:    ctx,
+		filter: filter,
+		policy: config.policy,
+		events: make(chan ChangeEvent[K, V], config.bufferSize),
+		done:   make(chan struct{}),
+	}
+	mt.watchers = append(mt.watchers, w)
+	if w.policy == BlockOnSlowConsumer {
+		w.wake, w.progress = make(chan struct{}, 1), make(chan struct{})
+		go mt.deliver(w)
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-w.done:
+			return
+		}
+		mt.mutex.Lock()
+		defer mt.mutex.Unlock()
+		mt.unwatchLocked(w)
+	}()
+	return w.events, nil
+}
+
+// unwatchLocked removes the watcher and closes its channel. The channel of a BlockOnSlowConsumer watcher is
+// closed by its delivery. The caller must hold mt.mutex.
+func (mt *Memtable[K, V]) unwatchLocked(w *watcher[K, V]) {
+	if idx := slices.Index(mt.watchers, w); idx >= 0 {
+		mt.watchers = slices.Delete(mt.watchers, idx, idx+1)
+		close(w.done)
+		if w.policy != BlockOnSlowConsumer {
+			close(w.events)
+		}
+	}
+}
+
+// deliver sends the queued events of a BlockOnSlowConsumer watcher to its channel until the watcher is removed
+func (mt *Memtable[K, V]) deliver(w *watcher[K, V]) {
+	defer close(w.events)
+	for {
+		mt.mutex.Lock()
+		events := w.queue
+		w.queue = nil
+		mt.mutex.Unlock()
+		if len(events) == 0 {
+			select {
+			case <-w.wake:
+				continue
+			case <-w.done:
+				return
+			}
+		}
+		for _, event := range events {
+			select {
+			case w.events <- event:
+			case <-w.done:
+				return
+			}
+			mt.mutex.Lock()
+			w.sent++
+			close(w.progress)
+			w.progress = make(chan struct{})
+			mt.mutex.Unlock()
+		}
+	}
+}
+
+// deliveriesLocked returns the number of events queued so far for each BlockOnSlowConsumer watcher. The caller must
+// hold mt.mutex.
+func (mt *Memtable[K, V]) deliveriesLocked() map[*watcher[K, V]]int {
+	deliveries := make(map[*watcher[K, V]]int)
+	for _, w := range mt.watchers {
+		if w.policy == BlockOnSlowConsumer && w.sent < w.queued {
+			deliveries[w] = w.queued
+		}
+	}
+	return deliveries
+}
+
+// awaitDelivery waits until the BlockOnSlowConsumer watchers have sent all events queued so far, no matter which
+// goroutine published them, their watch has ended or ctx is done. The caller must not hold mt.mutex.
+func (mt *Memtable[K, V]) awaitDelivery(ctx context.Context) {
+	mt.mutex.Lock()
+	deliveries := mt.deliveriesLocked()
+	mt.mutex.Unlock()
+watchers:
+	for w, queued := range deliveries {
+		for {
+			mt.mutex.Lock()
+			sent, progress := w.sent, w.progress
+			mt.mutex.Unlock()
+			if sent >= queued {
+				continue watchers
+			}
+			select {
+			case <-progress:
+			case <-w.done:
+				continue watchers
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// applyWrittenLocked applies the records of the outbox up to the first record which has not been written yet to
+// the index and publishes their events. The mutations of failed writes are dropped. Once all failed records have
+// been removed from the outbox, the log accepts new records again. The caller must hold mt.mutex.
+func (mt *Memtable[K, V]) applyWrittenLocked() {
+	for len(mt.outbox) > 0 {
+		entry := mt.outbox[0]
+		select {
+		case <-entry.pending.Done():
+		default:
+			return
+		}
+		mt.outbox = mt.outbox[1:]
+		if entry.pending.Err() == nil {
+			mt.publishLocked(mt.applyLocked(entry))
+		} else if len(mt.outbox) == 0 {
+			// the records queued after a failed one have failed as well
+			mt.log.Resume()
+		}
+	}
+}
+
+// settleLocked waits until the records of the outbox have been written and applies them, so the index holds all
+// written mutations. The caller must hold mt.mutex.
+func (mt *Memtable[K, V]) settleLocked() {
+	for _, entry := range mt.outbox {
+		entry.pending.Wait()
+	}
+	mt.applyWrittenLocked()
+}
+
+// publishLocked delivers the events to all matching watchers. Events of BlockOnSlowConsumer watchers are queued
+// for their delivery. The caller must hold mt.mutex.
+func (mt *Memtable[K, V]) publishLocked(events []ChangeEvent[K, V]) {
+	for _, event := range events {
+		for _, w := range slices.Clone(mt.watchers) {
+			if !w.filter.matches(event.Key) {
+				continue
+			}
+			switch w.policy {
+			case BlockOnSlowConsumer:
+				w.queue = append(w.queue, event)
+				w.queued++
+				select {
+				case w.wake <- struct{}{}:
+				default:
+				}
+			case DropEventsForSlowConsumer:
+				select {
+				case w.events <- event:
+				default:
+				}
+			default:
+				select {
+				case w.events <- event:
+				default:
+					mt.unwatchLocked(w)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package memtable
+
+import (
+	"context"
+	"github.com/mwildt/goodb/utils/testutils"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	testutils.RunWithTempDir("TestWatch", func(dir string) {
+		mt, err := CreateMemtable[int, string]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		ctx, cancel := context.WithCancel(context.Background())
+
+		all, err := mt.Watch(ctx, WatchAll[int]())
+		testutils.AssertNoError(t, err, "Fehler beim watch")
+		single, _ := mt.Watch(ctx, WatchKey(2))
+		ranged, _ := mt.Watch(ctx, WatchRange(10, 20))
+
+		mt.Set(context.Background(), 1, "eins")
+		mt.Set(context.Background(), 2, "zwei")
+		mt.Set(context.Background(), 2, "ZWEI")
+		mt.Delete(context.Background(), 3)
+		mt.Apply(context.Background(), NewWriteBatch[int, string]().Put(15, "fünfzehn").Delete(1))
+
+		expected := []ChangeEvent[int, string]{
+			{OperationSet, 1, "", "eins", false, 1},
+			{OperationSet, 2, "", "zwei", false, 2},
+			{OperationSet, 2, "zwei", "ZWEI", true, 3},
+			{OperationSet, 15, "", "fünfzehn", false, 5},
+			{OperationDelete, 1, "eins", "", true, 6},
+		}
+		for i, e := range expected {
+			event := <-all
+			testutils.Assert(t, event == e, "event %d: expected %v, but got %v", i, e, event)
+		}
+
+		event := <-single
+		testutils.Assert(t, event.NewValue == "zwei", "expected zwei for single key watch, but got %v", event)
+		event = <-single
+		testutils.Assert(t, event.NewValue == "ZWEI", "expected ZWEI for single key watch, but got %v", event)
+		event = <-ranged
+		testutils.Assert(t, event.Key == 15, "expected key 15 for range watch, but got %v", event)
+		testutils.Assert(t, len(ranged) == 0, "unexpected events in range watch")
+
+		cancel()
+		_, open := <-all
+		testutils.Assert(t, !open, "channel not closed after cancel")
+		mt.Close()
+	})
+}
+
+func TestWatch_SlowConsumer(t *testing.T) {
+	testutils.RunWithTempDir("TestWatch_SlowConsumer", func(dir string) {
+		mt, err := CreateMemtable[int, string]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+
+		disconnected, _ := mt.Watch(context.Background(), WatchAll[int](), WithBufferSize(2))
+		dropping, _ := mt.Watch(context.Background(), WatchAll[int](), WithBufferSize(2), WithSlowConsumerPolicy(DropEventsForSlowConsumer))
+		for i := 0; i < 5; i++ {
+			mt.Set(context.Background(), i, "x")
+		}
+
+		count := 0
+		for range disconnected {
+			count++
+		}
+		testutils.Assert(t, count == 2, "expected 2 buffered events before disconnect, but got %d", count)
+		testutils.Assert(t, len(dropping) == 2, "expected 2 buffered events, but got %d", len(dropping))
+
+		first := <-dropping
+		testutils.Assert(t, first.Key == 0, "expected oldest event to be kept, but got %v", first)
+
+		mt.Close()
+		remaining := 0
+		for range dropping {
+			remaining++
+		}
+		testutils.Assert(t, remaining == 1, "expected 1 remaining event after close, but got %d", remaining)
+		_, err = mt.Watch(context.Background(), WatchAll[int]())
+		testutils.Assert(t, err == ErrClosed, "expected ErrClosed, but got %v", err)
+	})
+}
+
+func TestWatch_BlockingConsumer(t *testing.T) {
+	testutils.RunWithTempDir("TestWatch_BlockingConsumer", func(dir string) {
+		mt, err := CreateMemtable[int, string]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		blocking, _ := mt.Watch(context.Background(), WatchAll[int](), WithBufferSize(1), WithSlowConsumerPolicy(BlockOnSlowConsumer))
+		mt.Set(context.Background(), 1, "eins")
+
+		written := make(chan error)
+		go func() {
+			_, err := mt.Set(context.Background(), 2, "zwei")
+			written <- err
+		}()
+		for _, found := mt.Get(2); !found; _, found = mt.Get(2) {
+			time.Sleep(time.Millisecond)
+		}
+		// the waiting writer does not hold the lock, so other writes are applied
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err = mt.Set(ctx, 3, "drei")
+		cancel()
+		testutils.AssertNoError(t, err, "Fehler beim schreiben")
+		value, _ := mt.Get(3)
+		testutils.Assert(t, value == "drei", "expected drei, but got %s", value)
+		select {
+		case <-written:
+			testutils.Assert(t, false, "writer has not waited for the consumer")
+		default:
+		}
+
+		for _, key := range []int{1, 2} {
+			event := <-blocking
+			testutils.Assert(t, event.Key == key, "expected key %d, but got %v", key, event)
+		}
+		testutils.AssertNoError(t, <-written, "Fehler beim schreiben")
+
+		// a stalled consumer does not block Close, waiting writers are released
+		go func() {
+			_, err := mt.Set(context.Background(), 4, "vier")
+			written <- err
+		}()
+		time.Sleep(10 * time.Millisecond)
+		mt.Close()
+		<-written
+		for range blocking {
+		}
+	})
+}
+
+func TestWatch_BlockingConsumerForeignEvents(t *testing.T) {
+	testutils.RunWithTempDir("TestWatch_BlockingConsumerForeignEvents", func(dir string) {
+		mt, err := CreateMemtable[int, string]("testmt", WithDatadir(dir))
+		testutils.AssertNoError(t, err, "Fehler beim erstellen der memtable")
+		defer mt.Close()
+		blocking, _ := mt.Watch(context.Background(), WatchKey(1), WithBufferSize(1), WithSlowConsumerPolicy(BlockOnSlowConsumer))
+		mt.Set(context.Background(), 1, "eins")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		mt.Set(ctx, 1, "uno")
+		cancel()
+
+		// writers wait for the events queued by others, even if they publish no events for the watcher
+		start := time.Now()
+		ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err = mt.Set(ctx, 2, "zwei")
+		cancel()
+		testutils.AssertNoError(t, err, "Fehler beim schreiben")
+		testutils.Assert(t, time.Since(start) >= 50*time.Millisecond, "writer has not waited for the consumer")
+
+		written := make(chan error)
+		go func() {
+			_, err := mt.Set(context.Background(), 3, "drei")
+			written <- err
+		}()
+		for _, value := range []string{"eins", "uno"} {
+			event := <-blocking
+			testutils.Assert(t, event.NewValue == value, "expected %s, but got %v", value, event)
+		}
+		testutils.AssertNoError(t, <-written, "Fehler beim schreiben")
+	})
+}
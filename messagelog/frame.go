@@ -0,0 +1,70 @@
+package messagelog
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+var (
+	// ErrTruncatedRecord is returned by Open if the last record has not been written completely
+	ErrTruncatedRecord = errors.New("truncated record")
+	// ErrCorruptRecord is returned by Open if the checksum of a record does not match its payload
+	ErrCorruptRecord = errors.New("corrupt record")
+)
+
+// A frame is the on-disk representation of a record: a 4 byte length prefix, a CRC32C checksum of the payload
+// and the payload. The highest bit of the length prefix marks checksummed frames, frames written before
+// checksums were introduced consist of the length prefix and the payload only.
+const (
+	checksumFlag    uint32 = 1 << 31
+	frameHeaderSize        = 8
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+func encodeFrame(payload []byte) []byte {
+	frame := make([]byte, frameHeaderSize+len(payload))
+	binary.LittleEndian.PutUint32(frame[0:4], uint32(len(payload))|checksumFlag)
+	binary.LittleEndian.PutUint32(frame[4:8], crc32.Checksum(payload, crcTable))
+	copy(frame[frameHeaderSize:], payload)
+	return frame
+}
+
+// readFrame reads the next frame and returns its payload and its size on disk. remaining is the number of
+// bytes left in the file, it prevents allocating buffers for garbage length prefixes. io.EOF is returned
+// only if no byte of a new frame could be read.
+func readFrame(reader io.Reader, remaining int64) (payload []byte, size int64, err error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(reader, header); err == io.EOF {
+		return nil, 0, io.EOF
+	} else if err != nil {
+		return nil, 0, ErrTruncatedRecord
+	}
+	size = 4
+	dataLen := binary.LittleEndian.Uint32(header)
+	checksummed := dataLen&checksumFlag != 0
+	dataLen &^= checksumFlag
+
+	var checksum uint32
+	if checksummed {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return nil, size, ErrTruncatedRecord
+		}
+		checksum = binary.LittleEndian.Uint32(header)
+		size += 4
+	}
+	if int64(dataLen) > remaining-size {
+		return nil, size, ErrTruncatedRecord
+	}
+	payload = make([]byte, int(dataLen))
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return nil, size, ErrTruncatedRecord
+	}
+	size += int64(dataLen)
+	if checksummed && crc32.Checksum(payload, crcTable) != checksum {
+		return nil, size, ErrCorruptRecord
+	}
+	return payload, size, nil
+}
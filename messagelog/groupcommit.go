@@ -0,0 +1,195 @@
+package messagelog
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+// ErrClosed is returned when appending to a closed log
+var ErrClosed = errors.New("message log closed")
+
+// Pending is a record queued by Enqueue. It is written to the file by the first goroutine waiting for it,
+// together with all other queued records, so concurrent appenders share a single write and sync.
+type Pending struct {
+	offset int
+	frame  []byte
+	done   chan struct{}
+	err    error
+	flush  func(done <-chan struct{})
+}
+
+// Wait writes the record, if no other goroutine did, and returns once it is durable according to the sync policy
+func (p *Pending) Wait() error {
+	p.flush(p.done)
+	return p.err
+}
+
+// Offset returns the offset of the record in the log
+func (p *Pending) Offset() int {
+	return p.offset
+}
+
+// Done is closed once the record has been written
+func (p *Pending) Done() <-chan struct{} {
+	return p.done
+}
+
+// Err returns the error of the write, it is valid after Done has been closed
+func (p *Pending) Err() error {
+	return p.err
+}
+
+// GroupCommitStats describes the groups of records written together
+type GroupCommitStats struct {
+	Groups       int // number of writes
+	Records      int // number of records in all groups
+	MaxGroupSize int
+	Syncs        int
+}
+
+// AverageGroupSize returns the mean number of records per write
+func (stats GroupCommitStats) AverageGroupSize() float64 {
+	if stats.Groups == 0 {
+		return 0
+	}
+	return float64(stats.Records) / float64(stats.Groups)
+}
+
+// Enqueue queues the message for writing and returns its Pending record. The order of Enqueue calls is the
+// order of the records in the log. After a failed write all records are rejected until Resume is called.
+func (mlog *MessageLog[V]) Enqueue(_ context.Context, message V) (*Pending, error) {
+	encoded, err := mlog.codec.Encode(message)
+	if err != nil {
+		return nil, err
+	}
+	mlog.mutex.Lock()
+	defer mlog.mutex.Unlock()
+	if mlog.closed {
+		return nil, ErrClosed
+	} else if mlog.broken != nil {
+		return nil, mlog.broken
+	} else if mlog.failed != nil {
+		return nil, mlog.failed
+	}
+	pending := &Pending{
+		offset: mlog.segments[0].base + mlog.messageCount,
+		frame:  encodeFrame(encoded),
+		done:   make(chan struct{}),
+		flush:  mlog.flushUntil,
+	}
+	mlog.queue = append(mlog.queue, pending)
+	mlog.messageCount = mlog.messageCount + 1
+	return pending, nil
+}
+
+// Append writes the message and returns once it is durable according to the sync policy
+func (mlog *MessageLog[V]) Append(ctx context.Context, message V) error {
+	if pending, err := mlog.Enqueue(ctx, message); err != nil {
+		return err
+	} else {
+		return pending.Wait()
+	}
+}
+
+// Resume accepts new records after a failed write. Until then the caller can handle the failed records without
+// records being queued, which have been prepared in expectation of them.
+func (mlog *MessageLog[V]) Resume() {
+	mlog.mutex.Lock()
+	defer mlog.mutex.Unlock()
+	mlog.failed = nil
+}
+
+// Stats returns the metrics of the group commits since the log has been created
+func (mlog *MessageLog[V]) Stats() GroupCommitStats {
+	mlog.mutex.Lock()
+	defer mlog.mutex.Unlock()
+	return mlog.stats
+}
+
+// flushUntil writes queued groups until done is closed
+func (mlog *MessageLog[V]) flushUntil(done <-chan struct{}) {
+	mlog.mutex.Lock()
+	defer mlog.mutex.Unlock()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		if mlog.flushing {
+			mlog.cond.Wait()
+		} else {
+			mlog.writeGroupLocked()
+		}
+	}
+}
+
+// writeGroupLocked writes all queued records with a single write. The caller must hold mlog.mutex, which is
+// released during the write, so new records can be queued for the next group meanwhile.
+func (mlog *MessageLog[V]) writeGroupLocked() {
+	group := mlog.queue
+	mlog.queue = nil
+	mlog.flushing = true
+	rollErr := mlog.rollIfFullLocked()
+	file := mlog.file
+	mlog.unsynced = mlog.unsynced + len(group)
+	syncGroup := mlog.options.syncPolicy.syncAfterAppend(mlog.unsynced)
+	if syncGroup {
+		mlog.unsynced = 0
+	}
+	mlog.mutex.Unlock()
+
+	buffer := make([]byte, 0)
+	for _, pending := range group {
+		buffer = append(buffer, pending.frame...)
+	}
+	err := rollErr
+	if err == nil {
+		_, err = file.Write(buffer)
+	}
+	if err == nil && syncGroup {
+		err = file.Sync()
+	}
+
+	mlog.mutex.Lock()
+	mlog.flushing = false
+	if err == nil {
+		active := &mlog.segments[len(mlog.segments)-1]
+		active.records = active.records + len(group)
+		active.size = active.size + int64(len(buffer))
+		close(mlog.appended)
+		mlog.appended = make(chan struct{})
+	} else {
+		mlog.discardLocked(group, rollErr == nil, err)
+	}
+	mlog.stats.Groups++
+	mlog.stats.Records += len(group)
+	mlog.stats.MaxGroupSize = max(mlog.stats.MaxGroupSize, len(group))
+	if syncGroup {
+		mlog.stats.Syncs++
+	}
+	for _, pending := range group {
+		pending.err = err
+		close(pending.done)
+	}
+	mlog.cond.Broadcast()
+}
+
+// discardLocked removes the records of a failed group write. The active segment is truncated to its size before
+// the write and the records queued meanwhile fail as well, so the next record follows the last written one. New
+// records are rejected until Resume, if the file can't be truncated for good. The caller must hold mlog.mutex.
+func (mlog *MessageLog[V]) discardLocked(group []*Pending, written bool, err error) {
+	mlog.failed = err
+	if active := mlog.segments[len(mlog.segments)-1]; written {
+		if truncErr := os.Truncate(active.filename, active.size); truncErr != nil {
+			mlog.broken = errors.Join(err, truncErr)
+		}
+	}
+	for _, pending := range mlog.queue {
+		pending.err = err
+		close(pending.done)
+	}
+	mlog.messageCount = mlog.messageCount - len(group) - len(mlog.queue)
+	mlog.queue = nil
+}
@@ -0,0 +1,108 @@
+package messagelog
+
+import (
+	"context"
+	"fmt"
+	"github.com/mwildt/goodb/utils/testutils"
+	"os"
+	"path"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestGroupCommit_ConcurrentAppend(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "testlog.data")
+		log, err := NewMessageLog[string](filename, WithSyncPolicy(SyncAlways()))
+		testutils.AssertNoError(t, err, "fehler beim erstellen")
+		log.Open(Noop[string]())
+
+		wg := sync.WaitGroup{}
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				err := log.Append(context.Background(), fmt.Sprintf("message %d", i))
+				testutils.AssertNoError(t, err, "fehler beim schreiben")
+			}(i)
+		}
+		wg.Wait()
+
+		stats := log.Stats()
+		testutils.Assert(t, stats.Records == 100, "expected 100 records, but got %d", stats.Records)
+		testutils.Assert(t, stats.Groups <= 100 && stats.Syncs == stats.Groups, "unexpected stats %+v", stats)
+		testutils.Assert(t, stats.AverageGroupSize() >= 1, "unexpected average group size %f", stats.AverageGroupSize())
+		log.Close()
+
+		reopened, _ := NewMessageLog[string](filename)
+		count, _ := reopened.Open(Noop[string]())
+		testutils.Assert(t, count == 100, "expected 100 records after reopen, but got %d", count)
+		reopened.Close()
+	})
+}
+
+func TestGroupCommit_CloseFlushesQueue(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "testlog.data")
+		log, err := NewMessageLog[string](filename)
+		testutils.AssertNoError(t, err, "fehler beim erstellen")
+		log.Open(Noop[string]())
+
+		pending, err := log.Enqueue(context.Background(), "message")
+		testutils.AssertNoError(t, err, "fehler beim einreihen")
+		log.Close()
+		<-pending.Done()
+		testutils.AssertNoError(t, pending.Err(), "queued record has not been written")
+
+		_, err = log.Enqueue(context.Background(), "message")
+		testutils.Assert(t, err == ErrClosed, "expected ErrClosed, but got %v", err)
+
+		reopened, _ := NewMessageLog[string](filename)
+		reopened.Open(Noop[string]())
+		testutils.Assert(t, reopened.MessageCount() == 1, "expected 1 record, but got %d", reopened.MessageCount())
+		reopened.Close()
+	})
+}
+
+func TestGroupCommit_FailedWrite(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "testlog.data")
+		log, err := NewMessageLog[string](filename)
+		testutils.AssertNoError(t, err, "fehler beim erstellen")
+		log.Open(Noop[string]())
+		log.Append(context.Background(), "eins")
+		stat, _ := os.Stat(filename)
+
+		// a partially written group followed by a failing write
+		writable := log.file
+		writable.Write([]byte("partial"))
+		log.file, _ = os.Open(filename)
+		first, _ := log.Enqueue(context.Background(), "zwei")
+		second, _ := log.Enqueue(context.Background(), "drei")
+		testutils.Assert(t, first.Wait() != nil && second.Wait() != nil, "expected failed writes")
+		testutils.Assert(t, log.MessageCount() == 1, "expected 1 record, but got %d", log.MessageCount())
+		truncated, _ := os.Stat(filename)
+		testutils.Assert(t, truncated.Size() == stat.Size(), "failed write has not been removed from the file")
+
+		log.file.Close()
+		log.file = writable
+		_, err = log.Enqueue(context.Background(), "vier")
+		testutils.Assert(t, err != nil, "expected rejected record before Resume")
+		log.Resume()
+		pending, err := log.Enqueue(context.Background(), "vier")
+		testutils.AssertNoError(t, err, "fehler beim einreihen")
+		testutils.AssertNoError(t, pending.Wait(), "fehler beim schreiben")
+		testutils.Assert(t, pending.Offset() == 1, "expected offset 1, but got %d", pending.Offset())
+		log.Close()
+
+		reopened, _ := NewMessageLog[string](filename)
+		messages := make([]string, 0)
+		reopened.Open(func(_ context.Context, message string) error {
+			messages = append(messages, message)
+			return nil
+		})
+		testutils.Assert(t, slices.Equal(messages, []string{"eins", "vier"}), "unexpected records %v", messages)
+		reopened.Close()
+	})
+}
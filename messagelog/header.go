@@ -0,0 +1,106 @@
+package messagelog
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mwildt/goodb/codecs"
+	"io"
+	"os"
+)
+
+// ErrCodecMismatch is returned by Open if a log file has been written with another codec than the configured one
+var ErrCodecMismatch = errors.New("codec mismatch")
+
+// A log file starts with a header: magic bytes, the version of the file format and the length prefixed name of
+// the codec of its records. Files written before headers were introduced start with the first frame, they are
+// read with the configured codec.
+var headerMagic = []byte("GOODBLOG")
+
+const headerVersion byte = 1
+
+func encodeHeader(codecName string) []byte {
+	header := make([]byte, 0, len(headerMagic)+3+len(codecName))
+	header = append(header, headerMagic...)
+	header = append(header, headerVersion)
+	header = binary.LittleEndian.AppendUint16(header, uint16(len(codecName)))
+	return append(header, codecName...)
+}
+
+// readHeader reads the header of a log file and returns the codec name and the size of the header. For files
+// without header the size is zero and the reader is left at the first frame.
+func readHeader(reader *bufio.Reader) (codecName string, size int64, err error) {
+	magic, _ := reader.Peek(len(headerMagic))
+	if !bytes.Equal(magic, headerMagic) {
+		if len(magic) > 0 && len(magic) < len(headerMagic) && bytes.HasPrefix(headerMagic, magic) {
+			return "", 0, ErrTruncatedRecord
+		}
+		return "", 0, nil
+	}
+	reader.Discard(len(headerMagic))
+	fixed := make([]byte, 3)
+	if _, err := io.ReadFull(reader, fixed); err != nil {
+		return "", 0, ErrTruncatedRecord
+	} else if fixed[0] != headerVersion {
+		return "", 0, fmt.Errorf("unsupported log file version %d", fixed[0])
+	}
+	name := make([]byte, binary.LittleEndian.Uint16(fixed[1:]))
+	if _, err := io.ReadFull(reader, name); err != nil {
+		return "", 0, ErrTruncatedRecord
+	}
+	return string(name), int64(len(headerMagic) + len(fixed) + len(name)), nil
+}
+
+// writeHeaderIfEmpty writes the header to a new log file and returns the size of the file
+func (mlog *MessageLog[V]) writeHeaderIfEmpty() (int64, error) {
+	stat, err := mlog.file.Stat()
+	if err != nil || stat.Size() > 0 {
+		return stat.Size(), err
+	}
+	header := encodeHeader(mlog.codecName)
+	_, err = mlog.file.Write(header)
+	return int64(len(header)), err
+}
+
+// ReadCodecName returns the name of the codec recorded in the first file of an existing log. found is false if the
+// log does not exist or is empty, the name is empty for files written before headers were introduced.
+func ReadCodecName(filename string, opts ...Option) (codecName string, found bool, err error) {
+	return readCodecName(filename, newOptions(opts))
+}
+
+func readCodecName(filename string, options options) (codecName string, found bool, err error) {
+	// without segments an unsegmented log file is read, it becomes the first segment of a segmented log
+	if segments, err := findSegments(filename, options.segmented()); err != nil {
+		return "", false, err
+	} else if len(segments) > 0 {
+		filename = segments[0].filename
+	}
+	file, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	if _, err := reader.Peek(1); err == io.EOF {
+		return "", false, nil
+	}
+	codecName, _, err = readHeader(reader)
+	return codecName, true, err
+}
+
+// selectCodec returns the codec of the registry named in the header of an existing log. New logs, logs without
+// header and logs with a truncated header use the default codec.
+func selectCodec[V any](filename string, codec codecs.Codec[V], options options) (codecs.Codec[V], error) {
+	name, found, err := readCodecName(filename, options)
+	if errors.Is(err, ErrTruncatedRecord) || !found || name == "" || name == codecs.NameOf(codec) {
+		return codec, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return codecs.Lookup[V](cmp.Or(options.registry, codecs.DefaultRegistry), name)
+}
@@ -0,0 +1,106 @@
+package messagelog
+
+import (
+	"context"
+	"errors"
+	"github.com/mwildt/goodb/codecs"
+	"github.com/mwildt/goodb/utils/testutils"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestHeader_WithCodec(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "testlog.data")
+		log, err := NewMessageLog[string](filename, WithCodec[string](codecs.NewJsonCodec[string]()))
+		testutils.AssertNoError(t, err, "fehler beim erstellen")
+		log.Open(Noop[string]())
+		log.Append(context.Background(), "message")
+		log.Close()
+
+		content, _ := os.ReadFile(filename)
+		testutils.Assert(t, strings.HasPrefix(string(content), "GOODBLOG"), "log file has no header")
+		testutils.Assert(t, strings.HasSuffix(string(content), `"message"`), "message has not been encoded as json")
+
+		reopened, _ := NewMessageLog[string](filename, WithCodec[string](codecs.NewJsonCodec[string]()))
+		messages := make([]string, 0)
+		_, err = reopened.Open(func(_ context.Context, message string) error {
+			messages = append(messages, message)
+			return nil
+		})
+		testutils.AssertNoError(t, err, "fehler beim öffnen")
+		testutils.Assert(t, len(messages) == 1 && messages[0] == "message", "unexpected messages %v", messages)
+		reopened.Close()
+	})
+}
+
+func TestHeader_CodecMismatch(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "testlog.data")
+		log, _ := NewMessageLog[string](filename, WithCodec[string](codecs.NewJsonCodec[string]()))
+		log.Open(Noop[string]())
+		log.Append(context.Background(), "message")
+		log.Close()
+
+		reopened, _ := NewMessageLog[string](filename, WithCodec(codecs.NewBase64JsonCodec[string]()))
+		_, err := reopened.Open(Noop[string]())
+		testutils.Assert(t, errors.Is(err, ErrCodecMismatch), "expected ErrCodecMismatch, but got %v", err)
+		reopened.Close()
+
+		_, err = NewMessageLog[int](filename, WithCodec[string](codecs.NewJsonCodec[string]()))
+		testutils.Assert(t, err != nil, "codec of another type has been accepted")
+	})
+}
+
+func TestHeader_SelectCodec(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "testlog.data")
+		log, _ := NewMessageLog[string](filename, WithCodec[string](codecs.NewMsgpackCodec[string]()))
+		log.Open(Noop[string]())
+		log.Append(context.Background(), "message")
+		log.Close()
+
+		reopened, err := NewMessageLog[string](filename)
+		testutils.AssertNoError(t, err, "fehler beim erstellen")
+		messages := make([]string, 0)
+		_, err = reopened.Open(func(_ context.Context, message string) error {
+			messages = append(messages, message)
+			return nil
+		})
+		testutils.AssertNoError(t, err, "fehler beim öffnen")
+		testutils.Assert(t, len(messages) == 1 && messages[0] == "message", "unexpected messages %v", messages)
+		reopened.Append(context.Background(), "second")
+		reopened.Close()
+
+		content, _ := os.ReadFile(filename)
+		testutils.Assert(t, strings.HasSuffix(string(content), "\xa6second"), "message has not been appended as msgpack")
+
+		_, err = NewMessageLog[string](filename, WithCodecRegistry(&codecs.Registry{}))
+		testutils.Assert(t, errors.Is(err, codecs.ErrUnknownCodec), "expected ErrUnknownCodec, but got %v", err)
+	})
+}
+
+func TestHeader_TruncatedHeaderIsRecovered(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "testlog.data")
+		os.WriteFile(filename, []byte("GOODB"), 0644)
+
+		log, _ := NewMessageLog[string](filename)
+		_, err := log.Open(Noop[string]())
+		testutils.Assert(t, errors.Is(err, ErrTruncatedRecord), "expected ErrTruncatedRecord, but got %v", err)
+		log.Close()
+
+		recovered, _ := NewMessageLog[string](filename, WithRecovery())
+		_, err = recovered.Open(Noop[string]())
+		testutils.AssertNoError(t, err, "fehler bei der wiederherstellung")
+		recovered.Append(context.Background(), "message")
+		recovered.Close()
+
+		reopened, _ := NewMessageLog[string](filename)
+		count, err := reopened.Open(Noop[string]())
+		testutils.Assert(t, err == nil && count == 1, "expected 1 record, but got %d (%v)", count, err)
+		reopened.Close()
+	})
+}
@@ -1,10 +1,15 @@
 // Contains a simple implementation of a write-ahead log for writing and reading messages.
-// Reading takes place once when the log is opened.
+// The log is read once when it is opened. Each record has an offset, a Reader reads the log from any offset and
+// follows new appends. Offsets are stable for the files of a log, deleting old segments keeps them. A new log
+// starts at offset 0, so offsets are not continued when a log is rewritten to new files, like the log of a
+// memtable on compaction without segments.
 package messagelog
 
 import (
+	"bufio"
 	"context"
-	"encoding/binary"
+	"errors"
+	"fmt"
 	"github.com/mwildt/goodb/codecs"
 	"io"
 	"log"
@@ -21,22 +26,71 @@ func Noop[V any]() MessageConsumer[V] {
 }
 
 type MessageLog[V any] struct {
-	file         *os.File
+	filename     string
+	file         *os.File  // the active segment
+	segments     []segment // ordered by base offset, the last one is the active segment
 	mutex        *sync.Mutex
 	messageCount int
 	codec        codecs.Codec[V]
+	codecName    string // recorded in the header of each file
+	options      options
+	unsynced     int           // records appended since the last sync
+	stop         chan struct{} // closed to stop the background sync
+	queue        []*Pending    // records waiting for the next group write
+	flushing     bool          // a group write is in progress
+	cond         *sync.Cond    // signals the end of a group write
+	stats        GroupCommitStats
+	closed       bool
+	broken       error         // set if a failed write could not be removed from the file
+	failed       error         // set by a failed write, rejects new records until Resume
+	appended     chan struct{} // closed and replaced after each group write
 }
 
-func NewMessageLog[V any](filename string) (log *MessageLog[V], err error) {
-	if file, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644); err != nil {
+func NewMessageLog[V any](filename string, opts ...Option) (log *MessageLog[V], err error) {
+	options := newOptions(opts)
+	if err := options.syncPolicy.validate(); err != nil {
+		return log, err
+	}
+	codec := codecs.Codec[V](codecs.NewBase64JsonCodec[V]())
+	if options.codec != nil {
+		var ok bool
+		if codec, ok = options.codec.(codecs.Codec[V]); !ok {
+			return log, fmt.Errorf("codec %T does not encode %T", options.codec, *new(V))
+		}
+	} else if codec, err = selectCodec(filename, codec, options); err != nil {
+		return log, err
+	}
+	segments, err := listSegments(filename, options.segmented())
+	if err != nil {
+		return log, err
+	}
+	if file, err := os.OpenFile(segments[len(segments)-1].filename, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644); err != nil {
 		return log, err
 	} else {
-		return &MessageLog[V]{
+		mutex := &sync.Mutex{}
+		mlog := &MessageLog[V]{
+			filename:     filename,
 			file:         file,
-			mutex:        &sync.Mutex{},
+			segments:     segments,
+			mutex:        mutex,
+			cond:         sync.NewCond(mutex),
 			messageCount: 0,
-			codec:        codecs.NewBase64JsonCodec[V](),
-		}, nil
+			codec:        codec,
+			codecName:    codecs.NameOf(codec),
+			options:      options,
+			stop:         make(chan struct{}),
+			appended:     make(chan struct{}),
+		}
+		if size, err := mlog.writeHeaderIfEmpty(); err != nil {
+			file.Close()
+			return log, err
+		} else {
+			mlog.segments[len(segments)-1].size = size
+		}
+		if policy := mlog.options.syncPolicy; policy.mode == syncInterval {
+			go mlog.syncPeriodically(policy.interval, mlog.stop)
+		}
+		return mlog, nil
 	}
 }
 
@@ -50,63 +104,173 @@ func (mlog *MessageLog[V]) Open(consumer MessageConsumer[V]) (writeCount int, er
 	}
 }
 
-func (mlog *MessageLog[V]) Append(_ context.Context, message V) (err error) {
-	mlog.mutex.Lock()
-	defer mlog.mutex.Unlock()
-	if encoded, err := mlog.codec.Encode(message); err != nil {
+// readAll passes all records of all segments to the consumer. Reading stops at the first truncated or corrupt
+// record, which either fails or, in recovery mode, truncates the log at the end of the last valid record.
+func (mlog *MessageLog[V]) readAll(ctx context.Context, consumer MessageConsumer[V]) (count int, err error) {
+	for i := 0; i < len(mlog.segments); i++ {
+		n, err := mlog.readSegment(ctx, i, consumer)
+		count = count + n
+		if err != nil {
+			return count, err
+		}
+	}
+	return count, nil
+}
+
+// Verify reads the records of an existing log and checks their checksums without decoding them. The segments are
+// read, if the log has been segmented. ErrTruncatedRecord or ErrCorruptRecord is returned for a damaged log.
+func Verify(filename string) error {
+	segments, err := findSegments(filename, true)
+	if err != nil {
 		return err
-	} else {
-		buffLenBytes := make([]byte, 4)
-		binary.LittleEndian.PutUint32(buffLenBytes, uint32(len(encoded)))
-		if _, err := mlog.file.Write(buffLenBytes); err != nil {
-			return err
-		} else if _, err := mlog.file.Write(encoded); err != nil {
-			return err
-		} else {
-			mlog.messageCount = mlog.messageCount + 1
+	} else if len(segments) == 0 {
+		segments = []segment{{filename: filename}}
+	}
+	for _, seg := range segments {
+		if err := verifyFile(seg.filename); err != nil {
+			return fmt.Errorf("%s: %w", seg.filename, err)
 		}
 	}
-	return err
+	return nil
 }
 
-func (mlog *MessageLog[V]) readAll(ctx context.Context, consumer MessageConsumer[V]) (count int, err error) {
+func verifyFile(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	reader := bufio.NewReader(file)
+	_, offset, err := readHeader(reader)
+	for err == nil {
+		var size int64
+		_, size, err = readFrame(reader, stat.Size()-offset)
+		offset += size
+	}
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
 
-	for {
-		lenBytes := make([]byte, 4)
-		if _, err := io.ReadFull(mlog.file, lenBytes); err != nil {
-			if err == io.EOF {
-				return count, nil
-			}
+// readSegment passes all records of the ith segment to the consumer and records its number of records and size
+func (mlog *MessageLog[V]) readSegment(ctx context.Context, i int, consumer MessageConsumer[V]) (count int, err error) {
+	file := mlog.file
+	if i < len(mlog.segments)-1 {
+		if file, err = os.Open(mlog.segments[i].filename); err != nil {
 			return count, err
 		}
-		dataLen := binary.LittleEndian.Uint32(lenBytes)
-		dataBuffer := make([]byte, int(dataLen))
-		if _, err := io.ReadFull(mlog.file, dataBuffer); err != nil {
+		defer file.Close()
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		return count, err
+	} else if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return count, err
+	}
+	reader := bufio.NewReader(file)
+	var offset int64
+	defer func() {
+		mlog.segments[i].records = count
+		mlog.segments[i].size = offset
+	}()
+	if codecName, size, err := readHeader(reader); err != nil {
+		return count, mlog.recover(i, offset, err)
+	} else if size > 0 && codecName != mlog.codecName {
+		return count, fmt.Errorf("%w: %s has been written with codec %s, not %s", ErrCodecMismatch, file.Name(), codecName, mlog.codecName)
+	} else {
+		offset = size
+	}
+	for {
+		payload, size, err := readFrame(reader, stat.Size()-offset)
+		if err == io.EOF {
+			return count, nil
+		} else if errors.Is(err, ErrTruncatedRecord) || errors.Is(err, ErrCorruptRecord) {
+			return count, mlog.recover(i, offset, err)
+		} else if err != nil {
 			return count, err
-		} else if message, err := mlog.codec.Decode(dataBuffer); err != nil {
+		} else if message, err := mlog.codec.Decode(payload); err != nil {
 			return count, err
 		} else if err = consumer(ctx, message); err != nil {
 			return count, err
 		} else {
 			count = count + 1
+			offset += size
+		}
+	}
+}
+
+// recover truncates the ith segment to offset and removes all later segments in recovery mode, otherwise it
+// returns the cause
+func (mlog *MessageLog[V]) recover(i int, offset int64, cause error) error {
+	filename := mlog.segments[i].filename
+	if !mlog.options.recover {
+		return fmt.Errorf("%w at offset %d of %s", cause, offset, filename)
+	}
+	log.Printf("MessageLog::Open %s at offset %d of %s, truncate log\n", cause.Error(), offset, filename)
+	if i < len(mlog.segments)-1 {
+		file, err := os.OpenFile(filename, os.O_RDWR|os.O_APPEND, 0644)
+		if err != nil {
+			return err
 		}
+		mlog.file.Close()
+		mlog.file = file
+		for _, later := range mlog.segments[i+1:] {
+			if err := os.Remove(later.filename); err != nil {
+				return err
+			}
+		}
+		mlog.segments = mlog.segments[:i+1]
+	}
+	if err := mlog.file.Truncate(offset); err != nil {
+		return err
+	} else if _, err := mlog.file.Seek(offset, io.SeekStart); err != nil {
+		return err
 	}
-	return count, err
+	// a truncated header is written again
+	size, err := mlog.writeHeaderIfEmpty()
+	mlog.segments[i].size = size
+	return err
 }
 
+// Close writes all queued records, syncs and closes the file
 func (mlog *MessageLog[V]) Close() error {
+	mlog.mutex.Lock()
+	defer mlog.mutex.Unlock()
+	if mlog.closed {
+		return nil
+	}
+	mlog.closed = true
+	for mlog.flushing || len(mlog.queue) > 0 {
+		if mlog.flushing {
+			mlog.cond.Wait()
+		} else {
+			mlog.writeGroupLocked()
+		}
+	}
+	close(mlog.stop)
+	close(mlog.appended)
 	mlog.file.Sync()
 	return mlog.file.Close()
 }
 
+// Delete removes all segments of the log
 func (mlog *MessageLog[V]) Delete() {
-	os.Remove(mlog.file.Name())
+	for _, seg := range mlog.segments {
+		os.Remove(seg.filename)
+	}
 }
 
 func (mlog *MessageLog[V]) MessageCount() int {
+	mlog.mutex.Lock()
+	defer mlog.mutex.Unlock()
 	return mlog.messageCount
 }
 
 func (mlog *MessageLog[V]) GetFilename() string {
-	return mlog.file.Name()
+	return mlog.filename
 }
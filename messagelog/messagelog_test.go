@@ -2,7 +2,10 @@ package messagelog
 
 import (
 	"context"
+	"encoding/binary"
+	"errors"
 	"github.com/mwildt/goodb/utils/testutils"
+	"os"
 
 	"path"
 	"testing"
@@ -45,3 +48,84 @@ func TestMessageLog_Append(t *testing.T) {
 	})
 
 }
+
+func writeMessages(t *testing.T, filename string, messages ...string) {
+	if log, err := NewMessageLog[string](filename); err != nil {
+		t.Fatalf(err.Error())
+	} else {
+		log.Open(Noop[string]())
+		for _, message := range messages {
+			log.Append(context.Background(), message)
+		}
+		log.Close()
+	}
+}
+
+func readMessages(filename string, opts ...Option) (messages []string, err error) {
+	if log, err := NewMessageLog[string](filename, opts...); err != nil {
+		return messages, err
+	} else {
+		defer log.Close()
+		_, err = log.Open(func(_ context.Context, message string) error {
+			messages = append(messages, message)
+			return nil
+		})
+		return messages, err
+	}
+}
+
+func TestMessageLog_TruncatedTail(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "testlog.data")
+		writeMessages(t, filename, "Hello", "World")
+		testutils.AssertNoError(t, Verify(filename), "intact log has not been verified")
+		stat, _ := os.Stat(filename)
+		os.Truncate(filename, stat.Size()-3)
+
+		_, err := readMessages(filename)
+		testutils.Assert(t, errors.Is(err, ErrTruncatedRecord), "expected ErrTruncatedRecord, but got %v", err)
+		err = Verify(filename)
+		testutils.Assert(t, errors.Is(err, ErrTruncatedRecord), "expected ErrTruncatedRecord from Verify, but got %v", err)
+
+		messages, err := readMessages(filename, WithRecovery())
+		testutils.AssertNoError(t, err, "fehler beim öffnen im recovery mode")
+		testutils.Assert(t, len(messages) == 1 && messages[0] == "Hello", "expected only Hello, but got %v", messages)
+
+		writeMessages(t, filename, "Again")
+		messages, err = readMessages(filename)
+		testutils.AssertNoError(t, err, "fehler beim öffnen nach recovery")
+		testutils.Assert(t, len(messages) == 2 && messages[1] == "Again", "expected Hello, Again, but got %v", messages)
+	})
+}
+
+func TestMessageLog_CorruptRecord(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "testlog.data")
+		writeMessages(t, filename, "Hello", "World")
+		data, _ := os.ReadFile(filename)
+		data[len(data)-1] ^= 0xff
+		os.WriteFile(filename, data, 0644)
+
+		_, err := readMessages(filename)
+		testutils.Assert(t, errors.Is(err, ErrCorruptRecord), "expected ErrCorruptRecord, but got %v", err)
+		err = Verify(filename)
+		testutils.Assert(t, errors.Is(err, ErrCorruptRecord), "expected ErrCorruptRecord from Verify, but got %v", err)
+		messages, err := readMessages(filename, WithRecovery())
+		testutils.AssertNoError(t, err, "fehler beim öffnen im recovery mode")
+		testutils.Assert(t, len(messages) == 1, "expected 1 message after recovery, but got %v", messages)
+	})
+}
+
+func TestMessageLog_LegacyFrames(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "testlog.data")
+		payload := []byte("IkhlbGxvIg") // base64 encoded json string "Hello"
+		frame := binary.LittleEndian.AppendUint32(nil, uint32(len(payload)))
+		os.WriteFile(filename, append(frame, payload...), 0644)
+		writeMessages(t, filename, "World")
+
+		messages, err := readMessages(filename)
+		testutils.AssertNoError(t, err, "fehler beim lesen von legacy frames")
+		testutils.Assert(t, len(messages) == 2 && messages[0] == "Hello", "expected Hello, World, but got %v", messages)
+	})
+}
@@ -0,0 +1,82 @@
+package messagelog
+
+import "github.com/mwildt/goodb/codecs"
+
+type options struct {
+	codec          any // codecs.Codec of the log's message type
+	registry       *codecs.Registry
+	recover        bool
+	syncPolicy     SyncPolicy
+	segmentSize    int64
+	segmentRecords int
+}
+
+type Option func(*options)
+
+func newOptions(opts []Option) options {
+	result := options{syncPolicy: SyncOSManaged()}
+	for _, opt := range opts {
+		opt(&result)
+	}
+	return result
+}
+
+// WithCodec sets the codec of the records, the default is codecs.NewBase64JsonCodec. The name of the codec is
+// recorded in the header of each log file, opening a file written with another codec fails with ErrCodecMismatch.
+// Without this option the codec of an existing log is selected by its name.
+func WithCodec[V any](codec codecs.Codec[V]) Option {
+	return func(o *options) {
+		o.codec = codec
+	}
+}
+
+// WithCodecRegistry sets the registry which selects the codec of an existing log opened without WithCodec, the
+// default is codecs.DefaultRegistry
+func WithCodecRegistry(registry *codecs.Registry) Option {
+	return func(o *options) {
+		o.registry = registry
+	}
+}
+
+// WithRecovery makes Open truncate the log after the last valid record instead of failing, if a truncated or
+// corrupt record is found. All records after the first invalid one are lost.
+func WithRecovery() Option {
+	return func(o *options) {
+		o.recover = true
+	}
+}
+
+// WithSyncPolicy sets when appended records are flushed to stable storage, the default is SyncOSManaged
+func WithSyncPolicy(policy SyncPolicy) Option {
+	return func(o *options) {
+		o.syncPolicy = policy
+	}
+}
+
+// WithSegmentSize splits the log into segment files and rolls to a new segment once the active one has grown
+// to size bytes. Segments are named after the log file followed by the offset of their first record.
+func WithSegmentSize(size int64) Option {
+	return func(o *options) {
+		o.segmentSize = size
+	}
+}
+
+// WithSegmentRecords splits the log into segment files like WithSegmentSize and rolls to a new segment once the
+// active one contains records records
+func WithSegmentRecords(records int) Option {
+	return func(o *options) {
+		o.segmentRecords = records
+	}
+}
+
+func (o options) segmented() bool {
+	return o.segmentSize > 0 || o.segmentRecords > 0
+}
+
+// segmentFull reports whether a segment with the given number of records and size has to be rolled
+func (o options) segmentFull(records int, size int64) bool {
+	if records == 0 {
+		return false
+	}
+	return (o.segmentSize > 0 && size >= o.segmentSize) || (o.segmentRecords > 0 && records >= o.segmentRecords)
+}
@@ -0,0 +1,123 @@
+package messagelog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"os"
+)
+
+// ErrOffsetOutOfRange is returned for offsets of deleted records or offsets beyond the end of the log
+var ErrOffsetOutOfRange = errors.New("offset out of range")
+
+// Reader reads the records of a log in order, starting at a given offset. Once all written records have been
+// read, Next waits for new records, so a Reader can follow the log for change data capture or replication.
+type Reader[V any] struct {
+	mlog     *MessageLog[V]
+	offset   int // offset of the next record returned by Next
+	file     *os.File
+	reader   *bufio.Reader
+	base     int // base offset of the open segment
+	position int // offset of the next record in the open segment
+}
+
+// NewReader returns a Reader starting at offset, which has to be between FirstOffset and NextOffset. The log
+// has to be opened before.
+func (mlog *MessageLog[V]) NewReader(offset int) (*Reader[V], error) {
+	mlog.mutex.Lock()
+	defer mlog.mutex.Unlock()
+	if offset < mlog.segments[0].base || offset > mlog.segments[0].base+mlog.messageCount {
+		return nil, ErrOffsetOutOfRange
+	}
+	return &Reader[V]{mlog: mlog, offset: offset}, nil
+}
+
+// Offset returns the offset of the next record returned by Next
+func (r *Reader[V]) Offset() int {
+	return r.offset
+}
+
+// Next returns the next record and its offset. If all written records have been read, Next waits until a new
+// record is written or ctx is done. io.EOF is returned once the log has been closed and all records have been read.
+func (r *Reader[V]) Next(ctx context.Context) (offset int, message V, err error) {
+	for {
+		r.mlog.mutex.Lock()
+		seg, found := r.mlog.segmentLocked(r.offset)
+		appended := r.mlog.appended
+		finished := r.mlog.closed && !r.mlog.flushing && len(r.mlog.queue) == 0
+		r.mlog.mutex.Unlock()
+
+		if !found {
+			return offset, message, ErrOffsetOutOfRange
+		} else if r.offset < seg.base+seg.records {
+			return r.read(seg)
+		} else if finished {
+			return offset, message, io.EOF
+		}
+		select {
+		case <-appended:
+		case <-ctx.Done():
+			return offset, message, ctx.Err()
+		}
+	}
+}
+
+// read returns the record at r.offset, which has been written to seg
+func (r *Reader[V]) read(seg segment) (offset int, message V, err error) {
+	if r.file == nil || r.base != seg.base || r.position > r.offset {
+		if err := r.open(seg); err != nil {
+			return offset, message, err
+		}
+	}
+	for {
+		// the record has been written completely, so the remaining size of the file does not matter
+		payload, _, err := readFrame(r.reader, math.MaxInt64)
+		if err != nil {
+			return offset, message, err
+		}
+		r.position++
+		if r.position > r.offset {
+			message, err = r.mlog.codec.Decode(payload)
+			offset = r.offset
+			r.offset++
+			return offset, message, err
+		}
+	}
+}
+
+func (r *Reader[V]) open(seg segment) (err error) {
+	r.Close()
+	if r.file, err = os.Open(seg.filename); err != nil {
+		return err
+	}
+	r.reader = bufio.NewReader(r.file)
+	if _, _, err = readHeader(r.reader); err != nil {
+		return err
+	}
+	r.base = seg.base
+	r.position = seg.base
+	return nil
+}
+
+// Close releases the file of the Reader
+func (r *Reader[V]) Close() error {
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
+
+// segmentLocked returns the segment containing the record at offset. Offsets of records which have not been
+// written yet belong to the active segment. The caller must hold mlog.mutex.
+func (mlog *MessageLog[V]) segmentLocked(offset int) (segment, bool) {
+	for i := len(mlog.segments) - 1; i >= 0; i-- {
+		if seg := mlog.segments[i]; seg.base <= offset {
+			return seg, i == len(mlog.segments)-1 || offset < seg.base+seg.records
+		}
+	}
+	return segment{}, false
+}
@@ -0,0 +1,81 @@
+package messagelog
+
+import (
+	"context"
+	"fmt"
+	"github.com/mwildt/goodb/utils/testutils"
+	"io"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestReader_FromOffset(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		log, _ := NewMessageLog[string](path.Join(dir, "testlog.data"), WithSegmentRecords(3))
+		log.Open(Noop[string]())
+		for i := 0; i < 10; i++ {
+			log.Append(context.Background(), fmt.Sprintf("message %d", i))
+		}
+
+		reader, err := log.NewReader(4)
+		testutils.AssertNoError(t, err, "fehler beim erstellen des readers")
+		for i := 4; i < 10; i++ {
+			offset, message, err := reader.Next(context.Background())
+			testutils.AssertNoError(t, err, "fehler beim lesen")
+			testutils.Assert(t, offset == i, "expected offset %d, but got %d", i, offset)
+			testutils.Assert(t, message == fmt.Sprintf("message %d", i), "unexpected message %s at offset %d", message, offset)
+		}
+		testutils.Assert(t, reader.Offset() == 10, "expected offset 10, but got %d", reader.Offset())
+		reader.Close()
+
+		_, err = log.NewReader(11)
+		testutils.Assert(t, err == ErrOffsetOutOfRange, "expected ErrOffsetOutOfRange, but got %v", err)
+		log.DeleteSegmentsBefore(6)
+		_, err = log.NewReader(2)
+		testutils.Assert(t, err == ErrOffsetOutOfRange, "expected ErrOffsetOutOfRange, but got %v", err)
+		log.Close()
+	})
+}
+
+func TestReader_Tail(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		log, _ := NewMessageLog[string](path.Join(dir, "testlog.data"), WithSegmentRecords(2))
+		log.Open(Noop[string]())
+		reader, err := log.NewReader(log.NextOffset())
+		testutils.AssertNoError(t, err, "fehler beim erstellen des readers")
+		defer reader.Close()
+
+		go func() {
+			for i := 0; i < 5; i++ {
+				time.Sleep(time.Millisecond)
+				log.Append(context.Background(), fmt.Sprintf("message %d", i))
+			}
+			log.Close()
+		}()
+
+		for i := 0; i < 5; i++ {
+			offset, message, err := reader.Next(context.Background())
+			testutils.AssertNoError(t, err, "fehler beim lesen")
+			testutils.Assert(t, offset == i && message == fmt.Sprintf("message %d", i), "unexpected message %s at offset %d", message, offset)
+		}
+		_, _, err = reader.Next(context.Background())
+		testutils.Assert(t, err == io.EOF, "expected io.EOF after close, but got %v", err)
+	})
+}
+
+func TestReader_Context(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		log, _ := NewMessageLog[string](path.Join(dir, "testlog.data"))
+		log.Open(Noop[string]())
+		log.Append(context.Background(), "message")
+		reader, _ := log.NewReader(1)
+		defer reader.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, _, err := reader.Next(ctx)
+		testutils.Assert(t, err == context.DeadlineExceeded, "expected context.DeadlineExceeded, but got %v", err)
+		log.Close()
+	})
+}
@@ -0,0 +1,141 @@
+package messagelog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// segment is one file of the log. An unsegmented log consists of a single segment.
+type segment struct {
+	filename string
+	base     int // offset of the first record of the segment
+	records  int
+	size     int64
+}
+
+// SegmentInfo describes a segment of the log
+type SegmentInfo struct {
+	Filename   string
+	BaseOffset int // offset of the first record of the segment
+	Records    int
+	Size       int64
+}
+
+func segmentFilename(filename string, base int) string {
+	return fmt.Sprintf("%s.%020d", filename, base)
+}
+
+// listSegments returns the segments of the log ordered by their base offset. An unsegmented log file found in
+// segmented mode becomes the first segment.
+func listSegments(filename string, segmented bool) ([]segment, error) {
+	segments, err := findSegments(filename, segmented)
+	if err != nil || len(segments) > 0 {
+		return segments, err
+	}
+	first := segment{filename: segmentFilename(filename, 0)}
+	if _, err := os.Stat(filename); err == nil {
+		return []segment{first}, os.Rename(filename, first.filename)
+	}
+	return []segment{first}, nil
+}
+
+// findSegments returns the existing segments of the log ordered by their base offset
+func findSegments(filename string, segmented bool) ([]segment, error) {
+	if !segmented {
+		return []segment{{filename: filename}}, nil
+	}
+	files, err := os.ReadDir(path.Dir(filename))
+	if err != nil {
+		return nil, err
+	}
+	pattern := regexp.MustCompile(fmt.Sprintf(`^%s\.(\d{20})$`, regexp.QuoteMeta(path.Base(filename))))
+	segments := make([]segment, 0)
+	for _, file := range files {
+		if matches := pattern.FindStringSubmatch(file.Name()); matches != nil && !file.IsDir() {
+			base, err := strconv.Atoi(matches[1])
+			if err != nil {
+				return nil, err
+			}
+			segments = append(segments, segment{filename: path.Join(path.Dir(filename), file.Name()), base: base})
+		}
+	}
+	slices.SortFunc(segments, func(a, b segment) int {
+		return a.base - b.base
+	})
+	return segments, nil
+}
+
+// rollIfFullLocked starts a new segment, if the active one reached the configured size or number of records.
+// The caller must hold mlog.mutex and no group write may be in progress.
+func (mlog *MessageLog[V]) rollIfFullLocked() error {
+	active := mlog.segments[len(mlog.segments)-1]
+	if !mlog.options.segmentFull(active.records, active.size) {
+		return nil
+	}
+	if err := mlog.syncLocked(); err != nil {
+		return err
+	}
+	next := segment{base: active.base + active.records}
+	next.filename = segmentFilename(mlog.filename, next.base)
+	file, err := os.OpenFile(next.filename, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	previous := mlog.file
+	mlog.file = file
+	if next.size, err = mlog.writeHeaderIfEmpty(); err != nil {
+		// the active segment stays in use, the next roll starts the segment again
+		mlog.file = previous
+		file.Close()
+		return errors.Join(err, os.Remove(next.filename))
+	}
+	previous.Close()
+	mlog.segments = append(mlog.segments, next)
+	return nil
+}
+
+// Segments returns the segments of the log ordered by their base offset, the last one is the active segment
+func (mlog *MessageLog[V]) Segments() []SegmentInfo {
+	mlog.mutex.Lock()
+	defer mlog.mutex.Unlock()
+	infos := make([]SegmentInfo, len(mlog.segments))
+	for i, seg := range mlog.segments {
+		infos[i] = SegmentInfo{seg.filename, seg.base, seg.records, seg.size}
+	}
+	return infos
+}
+
+// FirstOffset returns the offset of the first record which has not been deleted with DeleteSegmentsBefore
+func (mlog *MessageLog[V]) FirstOffset() int {
+	mlog.mutex.Lock()
+	defer mlog.mutex.Unlock()
+	return mlog.segments[0].base
+}
+
+// NextOffset returns the offset the next appended record will get
+func (mlog *MessageLog[V]) NextOffset() int {
+	mlog.mutex.Lock()
+	defer mlog.mutex.Unlock()
+	return mlog.segments[0].base + mlog.messageCount
+}
+
+// DeleteSegmentsBefore removes the oldest segments as long as all their records have an offset lower than offset.
+// The active segment is never removed. It returns the number of removed segments.
+func (mlog *MessageLog[V]) DeleteSegmentsBefore(offset int) (deleted int, err error) {
+	mlog.mutex.Lock()
+	defer mlog.mutex.Unlock()
+	for len(mlog.segments) > 1 && mlog.segments[0].base+mlog.segments[0].records <= offset {
+		if err := os.Remove(mlog.segments[0].filename); err != nil {
+			return deleted, err
+		}
+		mlog.messageCount = mlog.messageCount - mlog.segments[0].records
+		mlog.segments = mlog.segments[1:]
+		deleted++
+	}
+	return deleted, nil
+}
@@ -0,0 +1,148 @@
+package messagelog
+
+import (
+	"context"
+	"fmt"
+	"github.com/mwildt/goodb/utils/testutils"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestSegments_RollByRecords(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "testlog.data")
+		log, err := NewMessageLog[string](filename, WithSegmentRecords(3))
+		testutils.AssertNoError(t, err, "fehler beim erstellen")
+		log.Open(Noop[string]())
+		for i := 0; i < 10; i++ {
+			log.Append(context.Background(), fmt.Sprintf("message %d", i))
+		}
+		segments := log.Segments()
+		testutils.Assert(t, len(segments) == 4, "expected 4 segments, but got %d", len(segments))
+		for i, seg := range segments {
+			testutils.Assert(t, seg.BaseOffset == i*3, "expected base offset %d, but got %d", i*3, seg.BaseOffset)
+			testutils.Assert(t, seg.Filename == fmt.Sprintf("%s.%020d", filename, i*3), "unexpected filename %s", seg.Filename)
+		}
+		log.Close()
+
+		reopened, _ := NewMessageLog[string](filename, WithSegmentRecords(3))
+		messages := make([]string, 0)
+		reopened.Open(func(_ context.Context, message string) error {
+			messages = append(messages, message)
+			return nil
+		})
+		testutils.Assert(t, len(messages) == 10, "expected 10 messages, but got %d", len(messages))
+		for i, message := range messages {
+			testutils.Assert(t, message == fmt.Sprintf("message %d", i), "unexpected message %s at %d", message, i)
+		}
+
+		pending, _ := reopened.Enqueue(context.Background(), "message 10")
+		testutils.Assert(t, pending.Offset() == 10, "expected offset 10, but got %d", pending.Offset())
+		pending.Wait()
+		reopened.Close()
+	})
+}
+
+func TestSegments_RollBySize(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		log, err := NewMessageLog[string](path.Join(dir, "testlog.data"), WithSegmentSize(64))
+		testutils.AssertNoError(t, err, "fehler beim erstellen")
+		log.Open(Noop[string]())
+		for i := 0; i < 20; i++ {
+			log.Append(context.Background(), "message")
+		}
+		segments := log.Segments()
+		testutils.Assert(t, len(segments) > 1, "log has not been rolled")
+		for _, seg := range segments[:len(segments)-1] {
+			stat, _ := os.Stat(seg.Filename)
+			testutils.Assert(t, seg.Size >= 64 && seg.Size == stat.Size(), "unexpected segment size %d", seg.Size)
+		}
+		log.Close()
+	})
+}
+
+func TestSegments_DeleteSegmentsBefore(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "testlog.data")
+		log, _ := NewMessageLog[string](filename, WithSegmentRecords(2))
+		log.Open(Noop[string]())
+		for i := 0; i < 7; i++ {
+			log.Append(context.Background(), fmt.Sprintf("message %d", i))
+		}
+		deleted, err := log.DeleteSegmentsBefore(5)
+		testutils.AssertNoError(t, err, "fehler beim löschen")
+		testutils.Assert(t, deleted == 2, "expected 2 deleted segments, but got %d", deleted)
+		testutils.Assert(t, log.FirstOffset() == 4, "expected first offset 4, but got %d", log.FirstOffset())
+		testutils.Assert(t, log.MessageCount() == 3, "expected 3 messages, but got %d", log.MessageCount())
+
+		deleted, _ = log.DeleteSegmentsBefore(100)
+		testutils.Assert(t, deleted == 1 && len(log.Segments()) == 1, "the active segment must not be deleted")
+		log.Close()
+
+		reopened, _ := NewMessageLog[string](filename, WithSegmentRecords(2))
+		count, _ := reopened.Open(Noop[string]())
+		testutils.Assert(t, count == 1 && reopened.FirstOffset() == 6, "unexpected log after reopen: %d records from %d", count, reopened.FirstOffset())
+		reopened.Close()
+	})
+}
+
+func TestSegments_UnsegmentedLogBecomesFirstSegment(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "testlog.data")
+		log, _ := NewMessageLog[string](filename)
+		log.Open(Noop[string]())
+		log.Append(context.Background(), "message 0")
+		log.Append(context.Background(), "message 1")
+		log.Close()
+
+		segmented, err := NewMessageLog[string](filename, WithSegmentRecords(2))
+		testutils.AssertNoError(t, err, "fehler beim öffnen")
+		count, _ := segmented.Open(Noop[string]())
+		testutils.Assert(t, count == 2, "expected 2 records, but got %d", count)
+		segmented.Append(context.Background(), "message 2")
+		testutils.Assert(t, len(segmented.Segments()) == 2, "expected 2 segments, but got %d", len(segmented.Segments()))
+		segmented.Close()
+		_, err = os.Stat(filename)
+		testutils.Assert(t, os.IsNotExist(err), "unsegmented log has not been renamed")
+	})
+}
+
+func TestSegments_RecoverDropsLaterSegments(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "testlog.data")
+		log, _ := NewMessageLog[string](filename, WithSegmentRecords(2))
+		log.Open(Noop[string]())
+		for i := 0; i < 6; i++ {
+			log.Append(context.Background(), fmt.Sprintf("message %d", i))
+		}
+		segments := log.Segments()
+		log.Close()
+
+		stat, _ := os.Stat(segments[1].Filename)
+		os.Truncate(segments[1].Filename, stat.Size()-1)
+
+		_, err := openAndClose(filename, WithSegmentRecords(2))
+		testutils.Assert(t, err != nil, "expected error without recovery")
+
+		recovered, _ := NewMessageLog[string](filename, WithSegmentRecords(2), WithRecovery())
+		count, err := recovered.Open(Noop[string]())
+		testutils.AssertNoError(t, err, "fehler bei der wiederherstellung")
+		testutils.Assert(t, count == 3, "expected 3 records, but got %d", count)
+		testutils.Assert(t, len(recovered.Segments()) == 2, "expected 2 segments, but got %d", len(recovered.Segments()))
+		pending, _ := recovered.Enqueue(context.Background(), "message 3")
+		testutils.Assert(t, pending.Offset() == 3, "expected offset 3, but got %d", pending.Offset())
+		pending.Wait()
+		recovered.Close()
+	})
+}
+
+// openAndClose reads the log once and closes it
+func openAndClose(filename string, opts ...Option) (int, error) {
+	log, err := NewMessageLog[string](filename, opts...)
+	if err != nil {
+		return 0, err
+	}
+	defer log.Close()
+	return log.Open(Noop[string]())
+}
@@ -0,0 +1,102 @@
+package messagelog
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidSyncPolicy is returned by NewMessageLog for a sync interval or record count which is not positive
+var ErrInvalidSyncPolicy = errors.New("invalid sync policy")
+
+type syncMode int8
+
+const (
+	syncOSManaged syncMode = iota
+	syncAlways
+	syncInterval
+	syncEveryN
+)
+
+// SyncPolicy defines when appended records are flushed to stable storage
+type SyncPolicy struct {
+	mode     syncMode
+	interval time.Duration
+	records  int
+}
+
+// SyncAlways syncs the file before each Append returns
+func SyncAlways() SyncPolicy {
+	return SyncPolicy{mode: syncAlways}
+}
+
+// SyncInterval syncs the file in the background every interval, if records have been appended since the
+// last sync. The interval must be positive.
+func SyncInterval(interval time.Duration) SyncPolicy {
+	return SyncPolicy{mode: syncInterval, interval: interval}
+}
+
+// SyncEveryN syncs the file during every nth Append, records must be positive
+func SyncEveryN(records int) SyncPolicy {
+	return SyncPolicy{mode: syncEveryN, records: records}
+}
+
+// SyncOSManaged leaves flushing to the operating system, the file is synced on Close only
+func SyncOSManaged() SyncPolicy {
+	return SyncPolicy{mode: syncOSManaged}
+}
+
+func (policy SyncPolicy) validate() error {
+	if policy.mode == syncInterval && policy.interval <= 0 {
+		return fmt.Errorf("%w: interval %v", ErrInvalidSyncPolicy, policy.interval)
+	} else if policy.mode == syncEveryN && policy.records <= 0 {
+		return fmt.Errorf("%w: every %d records", ErrInvalidSyncPolicy, policy.records)
+	}
+	return nil
+}
+
+// syncAfterAppend reports whether Append has to sync, given the number of records appended since the last sync
+func (policy SyncPolicy) syncAfterAppend(unsynced int) bool {
+	switch policy.mode {
+	case syncAlways:
+		return true
+	case syncEveryN:
+		return unsynced >= policy.records
+	default:
+		return false
+	}
+}
+
+// syncPeriodically syncs the log in the configured interval until stop is closed
+func (mlog *MessageLog[V]) syncPeriodically(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			mlog.mutex.Lock()
+			if mlog.unsynced > 0 && !mlog.flushing {
+				mlog.syncLocked()
+			}
+			mlog.mutex.Unlock()
+		}
+	}
+}
+
+// syncLocked flushes the file, the caller must hold mlog.mutex
+func (mlog *MessageLog[V]) syncLocked() error {
+	if err := mlog.file.Sync(); err != nil {
+		return err
+	}
+	mlog.unsynced = 0
+	return nil
+}
+
+// Sync flushes all appended records to stable storage
+func (mlog *MessageLog[V]) Sync() error {
+	mlog.mutex.Lock()
+	defer mlog.mutex.Unlock()
+	return mlog.syncLocked()
+}
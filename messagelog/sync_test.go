@@ -0,0 +1,68 @@
+package messagelog
+
+import (
+	"context"
+	"errors"
+	"github.com/mwildt/goodb/utils/testutils"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestSyncPolicy_Append(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		policies := map[string]SyncPolicy{
+			"always":     SyncAlways(),
+			"every 2":    SyncEveryN(2),
+			"os managed": SyncOSManaged(),
+		}
+		expected := map[string][]int{
+			"always":     {0, 0, 0},
+			"every 2":    {1, 0, 1},
+			"os managed": {1, 2, 3},
+		}
+		for name, policy := range policies {
+			log, err := NewMessageLog[string](path.Join(dir, name), WithSyncPolicy(policy))
+			testutils.AssertNoError(t, err, "fehler beim erstellen")
+			log.Open(Noop[string]())
+			for i, unsynced := range expected[name] {
+				log.Append(context.Background(), "message")
+				testutils.Assert(t, log.unsynced == unsynced, "%s: expected %d unsynced records after append %d, but got %d", name, unsynced, i+1, log.unsynced)
+			}
+			log.Close()
+		}
+	})
+}
+
+func TestSyncPolicy_Interval(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		log, err := NewMessageLog[string](path.Join(dir, "testlog.data"), WithSyncPolicy(SyncInterval(10*time.Millisecond)))
+		testutils.AssertNoError(t, err, "fehler beim erstellen")
+		log.Open(Noop[string]())
+		log.Append(context.Background(), "message")
+
+		deadline := time.Now().Add(time.Second)
+		for time.Now().Before(deadline) {
+			log.mutex.Lock()
+			unsynced := log.unsynced
+			log.mutex.Unlock()
+			if unsynced == 0 {
+				break
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		log.mutex.Lock()
+		testutils.Assert(t, log.unsynced == 0, "record has not been synced in the background")
+		log.mutex.Unlock()
+		log.Close()
+	})
+}
+
+func TestSyncPolicy_Invalid(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		for _, policy := range []SyncPolicy{SyncInterval(0), SyncInterval(-time.Second), SyncEveryN(0), SyncEveryN(-1)} {
+			_, err := NewMessageLog[string](path.Join(dir, "testlog.data"), WithSyncPolicy(policy))
+			testutils.Assert(t, errors.Is(err, ErrInvalidSyncPolicy), "expected ErrInvalidSyncPolicy, but got %v", err)
+		}
+	})
+}
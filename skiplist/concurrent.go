@@ -0,0 +1,175 @@
+package skiplist
+
+import (
+	"github.com/mwildt/goodb/base"
+	"golang.org/x/exp/constraints"
+	"iter"
+	"sync"
+)
+
+// ConcurrentSkipList is a SkipList guarded by a RWMutex, so it can be shared by concurrent readers and writers.
+// Iterators do not hold the lock while yielding; each step seeks the next key under a read lock, so the
+// loop body may modify the list.
+type ConcurrentSkipList[K constraints.Ordered, V any] struct {
+	list  *SkipList[K, V]
+	mutex *sync.RWMutex
+}
+
+func NewConcurrentSkipList[K constraints.Ordered, V any]() *ConcurrentSkipList[K, V] {
+	return &ConcurrentSkipList[K, V]{
+		list:  NewSkipList[K, V](),
+		mutex: &sync.RWMutex{},
+	}
+}
+
+func (cs *ConcurrentSkipList[K, V]) Get(key K) (value V, found bool) {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+	return cs.list.Get(key)
+}
+
+func (cs *ConcurrentSkipList[K, V]) Set(key K, value V) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.list.Set(key, value)
+}
+
+func (cs *ConcurrentSkipList[K, V]) Delete(key K) bool {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	return cs.list.Delete(key)
+}
+
+func (cs *ConcurrentSkipList[K, V]) Size() int {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+	return cs.list.Size()
+}
+
+func (cs *ConcurrentSkipList[K, V]) Entries() []base.Entry[K, V] {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+	return cs.list.Entries()
+}
+
+// Range returns the entries with keys between from and to. Bounds, order and limit are controlled by opts.
+func (cs *ConcurrentSkipList[K, V]) Range(from, to K, opts base.RangeOptions) []base.Entry[K, V] {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+	return cs.list.Range(from, to, opts)
+}
+
+// RangeSeq returns an iterator over the entries with keys between from and to. Bounds, order and limit are
+// controlled by opts. Like All, the list may be modified during the iteration.
+func (cs *ConcurrentSkipList[K, V]) RangeSeq(from, to K, opts base.RangeOptions) iter.Seq2[K, V] {
+	// the iteration starts at the bound, which is skipped if it is excluded
+	bound, excluded, next := from, opts.ExcludeFrom, cs.list.higher
+	first := func() *skipListNode[K, V] {
+		node, _ := cs.list.search(from)
+		return node
+	}
+	if opts.Reverse {
+		bound, excluded, next = to, opts.ExcludeTo, cs.list.predecessor
+		first = func() *skipListNode[K, V] {
+			if node, _ := cs.list.search(to); node != nil && node.key == to {
+				return node
+			}
+			return cs.list.predecessor(to)
+		}
+	}
+	contains := func(key K) bool {
+		return (from < key || (from == key && !opts.ExcludeFrom)) && (key < to || (key == to && !opts.ExcludeTo))
+	}
+	return func(yield func(K, V) bool) {
+		node := cs.seek(first)
+		for count := 0; node != nil && (opts.Limit <= 0 || count < opts.Limit); {
+			if contains(node.key) {
+				if !yield(node.key, node.value) {
+					return
+				}
+				count++
+			} else if !excluded || node.key != bound {
+				return
+			}
+			key := node.key
+			node = cs.seek(func() *skipListNode[K, V] { return next(key) })
+		}
+	}
+}
+
+// All returns an iterator over all key-value pairs in ascending key order
+func (cs *ConcurrentSkipList[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		node := cs.seek(func() *skipListNode[K, V] { return cs.list.head })
+		for node != nil && yield(node.key, node.value) {
+			key := node.key
+			node = cs.seek(func() *skipListNode[K, V] { return cs.list.higher(key) })
+		}
+	}
+}
+
+// KeysSeq returns an iterator over all keys in ascending order
+func (cs *ConcurrentSkipList[K, V]) KeysSeq() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for key := range cs.All() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// ValuesSeq returns an iterator over all values in ascending key order
+func (cs *ConcurrentSkipList[K, V]) ValuesSeq() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, value := range cs.All() {
+			if !yield(value) {
+				return
+			}
+		}
+	}
+}
+
+// Backward returns an iterator over all key-value pairs in descending key order
+func (cs *ConcurrentSkipList[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		node := cs.seek(cs.list.last)
+		for node != nil && yield(node.key, node.value) {
+			key := node.key
+			node = cs.seek(func() *skipListNode[K, V] { return cs.list.predecessor(key) })
+		}
+	}
+}
+
+func (cs *ConcurrentSkipList[K, V]) Keys() <-chan K {
+	ch := make(chan K)
+	go func() {
+		for key := range cs.KeysSeq() {
+			ch <- key
+		}
+		close(ch)
+	}()
+	return ch
+}
+
+func (cs *ConcurrentSkipList[K, V]) Values() <-chan V {
+	ch := make(chan V)
+	go func() {
+		for value := range cs.ValuesSeq() {
+			ch <- value
+		}
+		close(ch)
+	}()
+	return ch
+}
+
+// seek runs find under the read lock and returns a detached copy of the found node, so key and value can be
+// read after the lock has been released.
+func (cs *ConcurrentSkipList[K, V]) seek(find func() *skipListNode[K, V]) *skipListNode[K, V] {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+	if node := find(); node != nil {
+		return &skipListNode[K, V]{key: node.key, value: node.value}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package skiplist
+
+import (
+	"github.com/mwildt/goodb/base"
+	"github.com/mwildt/goodb/utils/testutils"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentSkipList_ParallelAccess(t *testing.T) {
+	sl := NewConcurrentSkipList[int, int]()
+	wg := sync.WaitGroup{}
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func(offset int) {
+			defer wg.Done()
+			for i := 0; i < 250; i++ {
+				sl.Set(offset*1000+i, i)
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				for range sl.All() {
+				}
+				sl.Get(i)
+			}
+		}()
+	}
+	wg.Wait()
+	testutils.Assert(t, sl.Size() == 1000, "expected 1000 entries, but got %d", sl.Size())
+
+	last := -1
+	for key := range sl.KeysSeq() {
+		testutils.Assert(t, key > last, "falsche reihenfolge, %d nach %d", key, last)
+		last = key
+	}
+}
+
+func TestConcurrentSkipList_ModifyWhileIterating(t *testing.T) {
+	sl := NewConcurrentSkipList[int, string]()
+	for i := 0; i < 10; i++ {
+		sl.Set(i, "x")
+	}
+	count := 0
+	for key := range sl.All() {
+		sl.Delete(key)
+		count++
+	}
+	testutils.Assert(t, count == 10, "expected 10 iterations, but got %d", count)
+	testutils.Assert(t, sl.Size() == 0, "expected empty list, but got %d", sl.Size())
+
+	for i := 0; i < 10; i++ {
+		sl.Set(i, "x")
+	}
+	expected := 9
+	for key := range sl.Backward() {
+		testutils.Assert(t, key == expected, "falsche reihenfolge, %d erwartet, aber %d bekommen", expected, key)
+		sl.Delete(key)
+		expected--
+	}
+	testutils.Assert(t, expected == -1, "backward stopped at %d", expected)
+}
+
+func TestConcurrentSkipList_RangeSeq(t *testing.T) {
+	sl := NewConcurrentSkipList[int, int]()
+	for i := 0; i <= 20; i += 2 {
+		sl.Set(i, i*10)
+	}
+	bounds := [][2]int{{4, 12}, {3, 13}, {-5, 30}, {12, 4}, {6, 6}, {7, 7}}
+	for _, b := range bounds {
+		for _, opts := range rangeOptions() {
+			expected := sl.Range(b[0], b[1], opts)
+			entries := make([]base.Entry[int, int], 0)
+			for key, value := range sl.RangeSeq(b[0], b[1], opts) {
+				entries = append(entries, base.Entry[int, int]{Key: key, Value: value})
+			}
+			testutils.Assert(t, slices.Equal(entries, expected), "range %v %+v: expected %v, but got %v", b, opts, expected, entries)
+		}
+	}
+}
+
+func rangeOptions() (result []base.RangeOptions) {
+	for _, reverse := range []bool{false, true} {
+		for _, excludeFrom := range []bool{false, true} {
+			for _, excludeTo := range []bool{false, true} {
+				for _, limit := range []int{0, 2} {
+					result = append(result, base.RangeOptions{ExcludeFrom: excludeFrom, ExcludeTo: excludeTo, Reverse: reverse, Limit: limit})
+				}
+			}
+		}
+	}
+	return result
+}
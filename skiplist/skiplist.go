@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"github.com/mwildt/goodb/base"
 	"golang.org/x/exp/constraints"
+	"iter"
 	"log"
 	"math/rand"
+	"slices"
 )
 
 type GenericComparable[T any] interface {
@@ -74,6 +76,37 @@ func (sl *SkipList[K, V]) search(key K) (node *skipListNode[K, V], refs []*skipL
 	return node.next[0], refs
 }
 
+// last returns the node with the highest key
+func (sl *SkipList[K, V]) last() (node *skipListNode[K, V]) {
+	node = sl.head
+	if node == nil {
+		return node
+	}
+	for level := len(node.next) - 1; level >= 0; level-- {
+		for node.hasNext(level) {
+			node = node.next[level]
+		}
+	}
+	return node
+}
+
+// predecessor returns the node with the highest key lower than key
+func (sl *SkipList[K, V]) predecessor(key K) *skipListNode[K, V] {
+	if _, refs := sl.search(key); refs != nil {
+		return refs[0]
+	}
+	return nil
+}
+
+// higher returns the node with the lowest key greater than key
+func (sl *SkipList[K, V]) higher(key K) *skipListNode[K, V] {
+	node, _ := sl.search(key)
+	if node != nil && node.key == key {
+		return node.follower()
+	}
+	return node
+}
+
 func (sl *SkipList[K, V]) autoadjustLevel() {
 	if sl.Size() >= 2<<(sl.level) {
 		sl.increaseLevel()
@@ -114,8 +147,8 @@ func (sl *SkipList[K, V]) Get(key K) (value V, found bool) {
 		return value, false
 	}
 	node, _ := sl.search(key)
-	if node != nil {
-		return node.value, node.key == key
+	if node != nil && node.key == key {
+		return node.value, true
 	} else {
 		return value, false
 	}
@@ -212,12 +245,36 @@ func (sl *SkipList[K, V]) Delete(key K) bool {
 func (sl *SkipList[K, V]) Entries() (result []base.Entry[K, V]) {
 	current := sl.head
 	for current != nil {
-		result = append(result, base.Entry[K, V]{current.key, current.value})
+		result = append(result, base.Entry[K, V]{Key: current.key, Value: current.value})
 		current = current.next[0]
 	}
 	return result
 }
 
+// Range returns the entries with keys between from and to. Bounds, order and limit are controlled by opts.
+func (sl *SkipList[K, V]) Range(from, to K, opts base.RangeOptions) (result []base.Entry[K, V]) {
+	if sl.head == nil || from > to {
+		return result
+	}
+	node, _ := sl.search(from)
+	if node != nil && opts.ExcludeFrom && node.key == from {
+		node = node.follower()
+	}
+	for ; node != nil && (node.key < to || (node.key == to && !opts.ExcludeTo)); node = node.follower() {
+		result = append(result, base.Entry[K, V]{Key: node.key, Value: node.value})
+		if !opts.Reverse && opts.Limit > 0 && len(result) == opts.Limit {
+			return result
+		}
+	}
+	if opts.Reverse {
+		slices.Reverse(result)
+		if opts.Limit > 0 && len(result) > opts.Limit {
+			result = result[:opts.Limit]
+		}
+	}
+	return result
+}
+
 func (sl *SkipList[K, V]) Keys() <-chan K {
 	ch := make(chan K)
 	go func() {
@@ -244,6 +301,51 @@ func (sl *SkipList[K, V]) Values() <-chan V {
 	return ch
 }
 
+// All returns an iterator over all key-value pairs in ascending key order
+func (sl *SkipList[K, V]) All() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for node := sl.head; node != nil; node = node.follower() {
+			if !yield(node.key, node.value) {
+				return
+			}
+		}
+	}
+}
+
+// KeysSeq returns an iterator over all keys in ascending order
+func (sl *SkipList[K, V]) KeysSeq() iter.Seq[K] {
+	return func(yield func(K) bool) {
+		for key := range sl.All() {
+			if !yield(key) {
+				return
+			}
+		}
+	}
+}
+
+// ValuesSeq returns an iterator over all values in ascending key order
+func (sl *SkipList[K, V]) ValuesSeq() iter.Seq[V] {
+	return func(yield func(V) bool) {
+		for _, value := range sl.All() {
+			if !yield(value) {
+				return
+			}
+		}
+	}
+}
+
+// Backward returns an iterator over all key-value pairs in descending key order. As the list is only linked
+// forward, each step seeks the predecessor from the head.
+func (sl *SkipList[K, V]) Backward() iter.Seq2[K, V] {
+	return func(yield func(K, V) bool) {
+		for node := sl.last(); node != nil; node = sl.predecessor(node.key) {
+			if !yield(node.key, node.value) {
+				return
+			}
+		}
+	}
+}
+
 func (sl *SkipList[K, V]) Size() int {
 	return sl.size
 }
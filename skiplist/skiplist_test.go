@@ -1,6 +1,8 @@
 package skiplist
 
 import (
+	"fmt"
+	"github.com/mwildt/goodb/base"
 	"github.com/mwildt/goodb/utils/testutils"
 	"testing"
 )
@@ -80,8 +82,9 @@ func TestGet(t *testing.T) {
 
 	_, found = sl.Get(21)
 	testutils.Assert(t, !found, "found absent key (21)")
-	_, found = sl.Get(15)
+	value, found = sl.Get(15)
 	testutils.Assert(t, !found, "found absent key (21)")
+	testutils.Assert(t, value == "", "expected zero value for absent key, but got %s", value)
 
 	sl.Delete(10)
 	_, found = sl.Get(10)
@@ -221,3 +224,76 @@ func TestSkipList_Delete_First2(t *testing.T) {
 		t.Errorf("fehler value")
 	}
 }
+
+func TestSkipList_Range(t *testing.T) {
+	sl := NewSkipList[int, string]()
+	for _, i := range []int{50, 10, 30, 20, 40, 60, 0} {
+		sl.Set(i, "x")
+	}
+
+	keysOf := func(entries []base.Entry[int, string]) (keys []int) {
+		for _, entry := range entries {
+			keys = append(keys, entry.Key)
+		}
+		return keys
+	}
+	assertKeys := func(entries []base.Entry[int, string], expected ...int) {
+		keys := keysOf(entries)
+		testutils.Assert(t, len(keys) == len(expected), "falsche anzahl, %v erwartet, aber %v bekommen", expected, keys)
+		for i := 0; i < len(keys) && i < len(expected); i++ {
+			testutils.Assert(t, keys[i] == expected[i], "falsche reihenfolge, %v erwartet, aber %v bekommen", expected, keys)
+		}
+	}
+
+	assertKeys(sl.Range(10, 40, base.RangeOptions{}), 10, 20, 30, 40)
+	assertKeys(sl.Range(10, 40, base.RangeOptions{ExcludeFrom: true, ExcludeTo: true}), 20, 30)
+	assertKeys(sl.Range(15, 45, base.RangeOptions{}), 20, 30, 40)
+	assertKeys(sl.Range(-10, 100, base.RangeOptions{Limit: 2}), 0, 10)
+	assertKeys(sl.Range(-10, 100, base.RangeOptions{Reverse: true, Limit: 3}), 60, 50, 40)
+	assertKeys(sl.Range(0, 0, base.RangeOptions{}), 0)
+	assertKeys(sl.Range(0, 0, base.RangeOptions{ExcludeTo: true}))
+	assertKeys(sl.Range(61, 100, base.RangeOptions{}))
+	assertKeys(sl.Range(40, 10, base.RangeOptions{}))
+	assertKeys(NewSkipList[int, string]().Range(0, 10, base.RangeOptions{}))
+}
+
+func TestSkipList_Iterators(t *testing.T) {
+	sl := NewSkipList[int, string]()
+	for i := 0; i < 100; i++ {
+		sl.Set((i*37)%100, fmt.Sprintf("%d", (i*37)%100))
+	}
+
+	expected := 0
+	for key, value := range sl.All() {
+		testutils.Assert(t, key == expected, "falsche reihenfolge, %d erwartet, aber %d bekommen", expected, key)
+		testutils.Assert(t, value == fmt.Sprintf("%d", key), "falscher wert %s für key %d", value, key)
+		expected++
+	}
+	testutils.Assert(t, expected == 100, "expected 100 iterations, but got %d", expected)
+
+	expected = 99
+	for key := range sl.Backward() {
+		testutils.Assert(t, key == expected, "falsche reihenfolge, %d erwartet, aber %d bekommen", expected, key)
+		expected--
+	}
+	testutils.Assert(t, expected == -1, "backward did not reach the first key, stopped at %d", expected)
+
+	count := 0
+	for key := range sl.KeysSeq() {
+		if key == 9 {
+			break
+		}
+		count++
+	}
+	testutils.Assert(t, count == 9, "expected break after 9 keys, but got %d", count)
+
+	values := 0
+	for range sl.ValuesSeq() {
+		values++
+	}
+	testutils.Assert(t, values == 100, "expected 100 values, but got %d", values)
+
+	for range NewSkipList[int, string]().Backward() {
+		t.Errorf("backward on empty list yields values")
+	}
+}
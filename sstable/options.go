@@ -0,0 +1,68 @@
+package sstable
+
+import "github.com/mwildt/goodb/codecs"
+
+type options struct {
+	blockSize   int
+	blockFormat codecs.Format
+	codecName   string
+	metadata    []byte
+	registry    *codecs.Registry
+	bloomRate   float64 // false positive rate of the bloom filter, 0 writes no filter
+}
+
+type Option func(*options)
+
+func newOptions(opts []Option) options {
+	result := options{blockSize: 4096, blockFormat: codecs.RawFormat()}
+	for _, opt := range opts {
+		opt(&result)
+	}
+	return result
+}
+
+// WithBlockSize sets the size in bytes at which a data block is completed, the default is 4096
+func WithBlockSize(size int) Option {
+	return func(o *options) {
+		o.blockSize = size
+	}
+}
+
+// WithBlockFormat sets the format the data and index blocks are written with, e.g. to compress or encrypt them.
+// The default is codecs.RawFormat. The name of the format is recorded in the header of the table.
+func WithBlockFormat(format codecs.Format) Option {
+	return func(o *options) {
+		o.blockFormat = format
+	}
+}
+
+// WithCodecName records the name of the codec of the values in the header of a new table. Opening a table with
+// another codec name fails with ErrCodecMismatch.
+func WithCodecName(name string) Option {
+	return func(o *options) {
+		o.codecName = name
+	}
+}
+
+// WithMetadata records application defined data in a new table
+func WithMetadata(metadata []byte) Option {
+	return func(o *options) {
+		o.metadata = metadata
+	}
+}
+
+// WithCodecRegistry sets the registry which resolves the block format recorded in the header of a table, the
+// default is codecs.DefaultRegistry
+func WithCodecRegistry(registry *codecs.Registry) Option {
+	return func(o *options) {
+		o.registry = registry
+	}
+}
+
+// WithBloomFilter writes a bloom filter of the keys with the given false positive rate to a new table, Table.Get
+// skips the blocks for keys rejected by the filter. A rate of 0 writes no filter, which is the default.
+func WithBloomFilter(falsePositiveRate float64) Option {
+	return func(o *options) {
+		o.bloomRate = falsePositiveRate
+	}
+}
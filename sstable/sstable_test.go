@@ -0,0 +1,184 @@
+package sstable
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"github.com/mwildt/goodb/base"
+	"github.com/mwildt/goodb/codecs"
+	"github.com/mwildt/goodb/utils/testutils"
+	"os"
+	"path"
+	"testing"
+)
+
+// writeTable writes the keys 0, 2, ..., 2*(count-1) with the values "value-<key>"
+func writeTable(t *testing.T, filename string, count int, opts ...Option) *Table[int] {
+	writer, err := NewWriter[int](filename, opts...)
+	testutils.AssertNoError(t, err, "fehler beim erstellen")
+	for i := 0; i < count; i++ {
+		testutils.AssertNoError(t, writer.Add(2*i, []byte(fmt.Sprintf("value-%d", 2*i))), "fehler beim schreiben")
+	}
+	testutils.AssertNoError(t, writer.Close(), "fehler beim schließen")
+	table, err := Open[int](filename, opts...)
+	testutils.AssertNoError(t, err, "fehler beim öffnen")
+	return table
+}
+
+func keys(t *testing.T, entries func(func(base.Entry[int, []byte], error) bool)) (result []int) {
+	for entry, err := range entries {
+		testutils.AssertNoError(t, err, "fehler beim lesen")
+		testutils.Assert(t, string(entry.Value) == fmt.Sprintf("value-%d", entry.Key), "unexpected value %s of key %d", entry.Value, entry.Key)
+		result = append(result, entry.Key)
+	}
+	return result
+}
+
+func TestTable_Get(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		table := writeTable(t, path.Join(dir, "test.sst"), 1000, WithBlockSize(128))
+		defer table.Close()
+		testutils.Assert(t, len(table.blocks) > 10, "expected multiple blocks, but got %d", len(table.blocks))
+		testutils.Assert(t, table.Len() == 1000, "expected 1000 entries, but got %d", table.Len())
+		first, _ := table.First()
+		last, _ := table.Last()
+		testutils.Assert(t, first == 0 && last == 1998, "unexpected first %d and last key %d", first, last)
+
+		for _, key := range []int{0, 2, 500, 1998} {
+			value, found, err := table.Get(key)
+			testutils.Assert(t, err == nil && found && string(value) == fmt.Sprintf("value-%d", key), "key %d not found (%v)", key, err)
+		}
+		for _, key := range []int{-1, 1, 501, 1999, 5000} {
+			_, found, err := table.Get(key)
+			testutils.Assert(t, err == nil && !found, "unexpected key %d (%v)", key, err)
+		}
+	})
+}
+
+func TestTable_Iterators(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		table := writeTable(t, path.Join(dir, "test.sst"), 100, WithBlockSize(64))
+		defer table.Close()
+
+		all := keys(t, table.All())
+		testutils.Assert(t, len(all) == 100 && all[0] == 0 && all[99] == 198, "unexpected keys %v", all)
+		backward := keys(t, table.Backward())
+		testutils.Assert(t, len(backward) == 100 && backward[0] == 198 && backward[99] == 0, "unexpected keys %v", backward)
+
+		result := keys(t, table.Range(10, 20, base.RangeOptions{}))
+		testutils.Assert(t, fmt.Sprint(result) == "[10 12 14 16 18 20]", "unexpected keys %v", result)
+		result = keys(t, table.Range(9, 21, base.RangeOptions{Reverse: true, Limit: 3}))
+		testutils.Assert(t, fmt.Sprint(result) == "[20 18 16]", "unexpected keys %v", result)
+		result = keys(t, table.Range(10, 20, base.RangeOptions{ExcludeFrom: true, ExcludeTo: true}))
+		testutils.Assert(t, fmt.Sprint(result) == "[12 14 16 18]", "unexpected keys %v", result)
+		result = keys(t, table.Range(500, 600, base.RangeOptions{}))
+		testutils.Assert(t, len(result) == 0, "unexpected keys %v", result)
+	})
+}
+
+func TestWriter_Unordered(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "test.sst")
+		writer, _ := NewWriter[string](filename)
+		writer.Add("b", nil)
+		err := writer.Add("a", nil)
+		testutils.Assert(t, errors.Is(err, ErrUnordered), "expected ErrUnordered, but got %v", err)
+		err = writer.Add("b", nil)
+		testutils.Assert(t, errors.Is(err, ErrUnordered), "expected ErrUnordered, but got %v", err)
+		writer.Abort()
+		files, _ := os.ReadDir(dir)
+		testutils.Assert(t, len(files) == 0, "aborted table has not been removed")
+	})
+}
+
+func TestTable_Header(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "test.sst")
+		format := codecs.CompressionFormat(codecs.RawFormat(), codecs.GzipCompressor(gzip.DefaultCompression), 0)
+		table := writeTable(t, filename, 100, WithCodecName("binary/json"), WithMetadata([]byte("meta")), WithBlockFormat(format))
+		table.Close()
+		testutils.Assert(t, table.CodecName() == "binary/json" && string(table.Metadata()) == "meta", "unexpected header")
+
+		content, _ := os.ReadFile(filename)
+		testutils.Assert(t, !bytes.Contains(content, []byte("value-")), "blocks have not been compressed")
+		reopened, err := Open[int](filename)
+		testutils.AssertNoError(t, err, "fehler beim öffnen")
+		testutils.Assert(t, len(keys(t, reopened.All())) == 100, "compressed table could not be read")
+		reopened.Close()
+
+		_, err = Open[int](filename, WithCodecName("binary/gob"))
+		testutils.Assert(t, errors.Is(err, ErrCodecMismatch), "expected ErrCodecMismatch, but got %v", err)
+		_, err = Open[int](filename, WithCodecRegistry(&codecs.Registry{}))
+		testutils.Assert(t, errors.Is(err, codecs.ErrUnknownCodec), "expected ErrUnknownCodec, but got %v", err)
+	})
+}
+
+func TestWriter_SetMetadata(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "test.sst")
+		writer, _ := NewWriter[int](filename, WithMetadata([]byte("initial")), WithBlockSize(64))
+		for i := 0; i < 100; i++ {
+			writer.Add(i, []byte("value"))
+		}
+		testutils.Assert(t, writer.Size() > int64(100*len("value")), "unexpected size %d", writer.Size())
+		writer.SetMetadata([]byte("final"))
+		testutils.AssertNoError(t, writer.Close(), "fehler beim schließen")
+
+		table, err := Open[int](filename)
+		testutils.AssertNoError(t, err, "fehler beim öffnen")
+		testutils.Assert(t, string(table.Metadata()) == "final", "unexpected metadata %s", table.Metadata())
+		table.Close()
+	})
+}
+
+func TestTable_BloomFilter(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "test.sst")
+		writeTable(t, filename, 1000, WithBloomFilter(0.01), WithBlockSize(64)).Close()
+		content, _ := os.ReadFile(filename)
+		content[40] ^= 1
+		os.WriteFile(filename, content, 0644)
+
+		table, err := Open[int](filename)
+		testutils.AssertNoError(t, err, "fehler beim öffnen")
+		testutils.Assert(t, table.filter != nil, "table has no filter")
+		// the corrupt first block is only read for keys passing the filter
+		skipped := 0
+		for key := 1; key < 20; key += 2 {
+			if !table.MayContain(key) {
+				_, found, err := table.Get(key)
+				testutils.Assert(t, err == nil && !found, "unexpected key %d (%v)", key, err)
+				skipped++
+			}
+		}
+		testutils.Assert(t, skipped > 5, "expected the filter to reject absent keys, but %d have been rejected", skipped)
+		_, _, err = table.Get(0)
+		testutils.Assert(t, errors.Is(err, ErrCorrupt), "expected ErrCorrupt, but got %v", err)
+		testutils.Assert(t, !table.MayContain(5000), "key outside of the table has been accepted")
+		table.Close()
+	})
+}
+
+func TestTable_Corrupt(t *testing.T) {
+	testutils.RunWithTempDir("testdata", func(dir string) {
+		filename := path.Join(dir, "test.sst")
+		writeTable(t, filename, 100, WithBlockSize(64)).Close()
+		content, _ := os.ReadFile(filename)
+
+		content[40] ^= 1
+		os.WriteFile(filename, content, 0644)
+		table, err := Open[int](filename)
+		testutils.AssertNoError(t, err, "fehler beim öffnen")
+		_, _, err = table.Get(0)
+		testutils.Assert(t, errors.Is(err, ErrCorrupt), "expected ErrCorrupt, but got %v", err)
+		for _, err = range table.All() {
+		}
+		testutils.Assert(t, errors.Is(err, ErrCorrupt), "expected ErrCorrupt, but got %v", err)
+		table.Close()
+
+		os.WriteFile(filename, content[:len(content)-10], 0644)
+		_, err = Open[int](filename)
+		testutils.Assert(t, errors.Is(err, ErrCorrupt), "expected ErrCorrupt, but got %v", err)
+	})
+}
@@ -0,0 +1,300 @@
+package sstable
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"github.com/mwildt/goodb/base"
+	"github.com/mwildt/goodb/bloom"
+	"github.com/mwildt/goodb/codecs"
+	"golang.org/x/exp/constraints"
+	"hash/crc32"
+	"io"
+	"iter"
+	"os"
+	"slices"
+)
+
+// Table is an open table. It is safe for concurrent use.
+type Table[K constraints.Ordered] struct {
+	filename  string
+	file      *os.File
+	size      int64
+	format    codecs.Format
+	codecName string
+	metadata  []byte
+	filter    *bloom.Filter // nil if the table has been written without WithBloomFilter
+	blocks    []blockHandle[K]
+	count     int
+}
+
+// blockHandle is the index entry of a data block
+type blockHandle[K constraints.Ordered] struct {
+	first, last  K
+	offset, size int64
+}
+
+// Open opens an existing table
+func Open[K constraints.Ordered](filename string, opts ...Option) (*Table[K], error) {
+	options := newOptions(opts)
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	table := &Table[K]{filename: filename, file: file}
+	if err = table.init(options); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return table, nil
+}
+
+func (table *Table[K]) init(options options) error {
+	if stat, err := table.file.Stat(); err != nil {
+		return err
+	} else {
+		table.size = stat.Size()
+	}
+	reader := bufio.NewReader(io.NewSectionReader(table.file, 0, table.size))
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(reader, header); err != nil || !bytes.Equal(header[:len(magic)], magic) {
+		return fmt.Errorf("%w: missing header", ErrCorrupt)
+	} else if header[len(magic)] != version {
+		return fmt.Errorf("unsupported sstable version %d", header[len(magic)])
+	}
+	codecName, err := readBytes(reader)
+	if err != nil {
+		return err
+	}
+	formatName, err := readBytes(reader)
+	if err != nil {
+		return err
+	}
+	table.codecName = string(codecName)
+	if options.codecName != "" && options.codecName != table.codecName {
+		return fmt.Errorf("%w: table has been written with codec %s, not %s", ErrCodecMismatch, table.codecName, options.codecName)
+	}
+	if table.format, err = cmp.Or(options.registry, codecs.DefaultRegistry).Format(string(formatName)); err != nil {
+		return err
+	}
+
+	if table.size < footerSize {
+		return fmt.Errorf("%w: missing footer", ErrCorrupt)
+	}
+	data := make([]byte, footerSize)
+	if _, err := table.file.ReadAt(data, table.size-footerSize); err != nil {
+		return err
+	} else if !bytes.Equal(data[7*8:], magic) {
+		return fmt.Errorf("%w: missing footer", ErrCorrupt)
+	}
+	footer := make([]int64, 7)
+	for i := range footer {
+		footer[i] = int64(binary.LittleEndian.Uint64(data[i*8:]))
+	}
+	if table.metadata, err = table.readBlock(footer[0], footer[1]); err != nil {
+		return err
+	}
+	if footer[3] > 0 {
+		if data, err = table.readBlock(footer[2], footer[3]); err != nil {
+			return err
+		}
+		table.filter = &bloom.Filter{}
+		if err = table.filter.UnmarshalBinary(data); err != nil {
+			return fmt.Errorf("%w: %v", ErrCorrupt, err)
+		}
+	}
+	table.count = int(footer[6])
+	index, err := table.readBlock(footer[4], footer[5])
+	if err != nil {
+		return err
+	}
+	decoder := codecs.NewBinaryDecoder(index)
+	for decoder.Remaining() > 0 && decoder.Err() == nil {
+		handle := blockHandle[K]{first: codecs.DecodeOrdered[K](decoder), last: codecs.DecodeOrdered[K](decoder)}
+		handle.offset = int64(decoder.Uvarint())
+		handle.size = int64(decoder.Uvarint())
+		table.blocks = append(table.blocks, handle)
+	}
+	return decoder.Err()
+}
+
+func readBytes(reader *bufio.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, fmt.Errorf("%w: truncated header", ErrCorrupt)
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, fmt.Errorf("%w: truncated header", ErrCorrupt)
+	}
+	return data, nil
+}
+
+// readBlock reads a block, verifies its checksum and decodes it with the block format
+func (table *Table[K]) readBlock(offset, size int64) ([]byte, error) {
+	if size < 4 || offset < 0 || offset+size > table.size {
+		return nil, fmt.Errorf("%w: invalid block position", ErrCorrupt)
+	}
+	data := make([]byte, size)
+	if _, err := table.file.ReadAt(data, offset); err != nil {
+		return nil, err
+	}
+	data, checksum := data[:size-4], binary.LittleEndian.Uint32(data[size-4:])
+	if crc32.ChecksumIEEE(data) != checksum {
+		return nil, fmt.Errorf("%w: checksum mismatch of block at %d", ErrCorrupt, offset)
+	}
+	var block []byte
+	err := table.format.Unmarshal(data, &block)
+	return block, err
+}
+
+// readEntries reads and decodes the entries of a data block
+func (table *Table[K]) readEntries(handle blockHandle[K]) ([]base.Entry[K, []byte], error) {
+	block, err := table.readBlock(handle.offset, handle.size)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]base.Entry[K, []byte], 0)
+	decoder := codecs.NewBinaryDecoder(block)
+	for decoder.Remaining() > 0 && decoder.Err() == nil {
+		entries = append(entries, base.Entry[K, []byte]{Key: codecs.DecodeOrdered[K](decoder), Value: decoder.Bytes()})
+	}
+	if decoder.Err() != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, decoder.Err())
+	}
+	return entries, nil
+}
+
+// Get returns the value of key. Keys rejected by the bloom filter are not searched in the blocks.
+func (table *Table[K]) Get(key K) (value []byte, found bool, err error) {
+	if !table.MayContain(key) {
+		return nil, false, nil
+	}
+	i, _ := slices.BinarySearchFunc(table.blocks, key, func(handle blockHandle[K], key K) int {
+		return cmp.Compare(handle.last, key)
+	})
+	if i == len(table.blocks) || table.blocks[i].first > key {
+		return nil, false, nil
+	}
+	entries, err := table.readEntries(table.blocks[i])
+	if err != nil {
+		return nil, false, err
+	}
+	if j, found := slices.BinarySearchFunc(entries, key, func(entry base.Entry[K, []byte], key K) int {
+		return cmp.Compare(entry.Key, key)
+	}); found {
+		return entries[j].Value, true, nil
+	}
+	return nil, false, nil
+}
+
+// All returns an iterator over all entries in ascending key order. An error ends the iteration.
+func (table *Table[K]) All() iter.Seq2[base.Entry[K, []byte], error] {
+	return table.scan(table.blocks, func(K) bool { return true }, false, 0)
+}
+
+// Backward returns an iterator over all entries in descending key order. An error ends the iteration.
+func (table *Table[K]) Backward() iter.Seq2[base.Entry[K, []byte], error] {
+	return table.scan(table.blocks, func(K) bool { return true }, true, 0)
+}
+
+// Range returns an iterator over the entries with keys between from and to. Bounds, order and limit are
+// controlled by opts. An error ends the iteration.
+func (table *Table[K]) Range(from, to K, opts base.RangeOptions) iter.Seq2[base.Entry[K, []byte], error] {
+	start, _ := slices.BinarySearchFunc(table.blocks, from, func(handle blockHandle[K], key K) int {
+		return cmp.Compare(handle.last, key)
+	})
+	end := start
+	for end < len(table.blocks) && table.blocks[end].first <= to {
+		end++
+	}
+	contains := func(key K) bool {
+		return (from < key || (from == key && !opts.ExcludeFrom)) && (key < to || (key == to && !opts.ExcludeTo))
+	}
+	return table.scan(table.blocks[start:end], contains, opts.Reverse, opts.Limit)
+}
+
+func (table *Table[K]) scan(blocks []blockHandle[K], contains func(K) bool, reverse bool, limit int) iter.Seq2[base.Entry[K, []byte], error] {
+	return func(yield func(base.Entry[K, []byte], error) bool) {
+		count := 0
+		for i := range blocks {
+			if reverse {
+				i = len(blocks) - 1 - i
+			}
+			entries, err := table.readEntries(blocks[i])
+			if err != nil {
+				yield(base.Entry[K, []byte]{}, err)
+				return
+			}
+			if reverse {
+				slices.Reverse(entries)
+			}
+			for _, entry := range entries {
+				if !contains(entry.Key) {
+					continue
+				} else if !yield(entry, nil) {
+					return
+				} else if count++; limit > 0 && count == limit {
+					return
+				}
+			}
+		}
+	}
+}
+
+// MayContain reports whether the table may contain key. It is false if the bloom filter or the key range of the
+// table exclude key.
+func (table *Table[K]) MayContain(key K) bool {
+	first, found := table.First()
+	last, _ := table.Last()
+	if !found || key < first || last < key {
+		return false
+	}
+	return table.filter == nil || table.filter.MayContain(codecs.AppendOrdered(nil, key))
+}
+
+// First returns the smallest key of the table, found is false for empty tables
+func (table *Table[K]) First() (key K, found bool) {
+	if len(table.blocks) == 0 {
+		return key, false
+	}
+	return table.blocks[0].first, true
+}
+
+// Last returns the greatest key of the table, found is false for empty tables
+func (table *Table[K]) Last() (key K, found bool) {
+	if len(table.blocks) == 0 {
+		return key, false
+	}
+	return table.blocks[len(table.blocks)-1].last, true
+}
+
+// Len returns the number of entries
+func (table *Table[K]) Len() int {
+	return table.count
+}
+
+// Size returns the size of the table file in bytes
+func (table *Table[K]) Size() int64 {
+	return table.size
+}
+
+// Metadata returns the metadata recorded by WithMetadata or Writer.SetMetadata
+func (table *Table[K]) Metadata() []byte {
+	return table.metadata
+}
+
+// CodecName returns the codec name recorded by WithCodecName
+func (table *Table[K]) CodecName() string {
+	return table.codecName
+}
+
+func (table *Table[K]) Filename() string {
+	return table.filename
+}
+
+func (table *Table[K]) Close() error {
+	return table.file.Close()
+}
@@ -0,0 +1,206 @@
+// Contains an immutable file of key-value pairs sorted by key (sorted string table). Entries are stored in blocks,
+// an index of the first and last key of each block allows to read single entries without reading the whole file.
+// Keys are encoded with codecs.AppendOrdered, values are opaque bytes.
+//
+// A table consists of a header with magic bytes, version, codec name and block format name, the data blocks, the
+// metadata block, an optional bloom filter of the keys, the index block and a fixed size footer with the positions
+// of the metadata, filter and index blocks and the number of entries. Each block is followed by its CRC-32 checksum.
+package sstable
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/mwildt/goodb/bloom"
+	"github.com/mwildt/goodb/codecs"
+	"github.com/mwildt/goodb/internal/fsutil"
+	"golang.org/x/exp/constraints"
+	"hash/crc32"
+	"os"
+)
+
+var (
+	// ErrCodecMismatch is returned by Open if a table has been written with another codec than the expected one
+	ErrCodecMismatch = errors.New("codec mismatch")
+	// ErrCorrupt is returned when a table is truncated or a block does not match its checksum
+	ErrCorrupt = errors.New("corrupt sstable")
+	// ErrUnordered is returned by Writer.Add if a key is not greater than the previous key
+	ErrUnordered = errors.New("keys not in ascending order")
+)
+
+var magic = []byte("GOODBSST")
+
+const version byte = 1
+
+// footerSize is the size of the footer: offset and size of the metadata, filter and index blocks, number of
+// entries and magic bytes. Tables without a filter have a filter block of size 0.
+var footerSize = int64(7*8 + len(magic))
+
+// Writer writes a new table. The entries are written to a temporary file, which is renamed to the filename of the
+// table by Close, so a table is either complete or absent.
+type Writer[K constraints.Ordered] struct {
+	filename string
+	file     *os.File
+	writer   *bufio.Writer
+	options  options
+	offset   int64
+	block    []byte // entries of the current data block
+	first    K      // first key of the current data block
+	last     K      // last key added
+	index    []byte
+	count    int
+	metadata []byte
+	hashes   []uint64 // hashes of the keys for the bloom filter
+}
+
+// NewWriter creates a writer of the table filename
+func NewWriter[K constraints.Ordered](filename string, opts ...Option) (*Writer[K], error) {
+	file, err := os.Create(filename + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer[K]{
+		filename: filename,
+		file:     file,
+		writer:   bufio.NewWriter(file),
+		options:  newOptions(opts),
+	}
+	w.metadata = w.options.metadata
+	header := append([]byte{}, magic...)
+	header = append(header, version)
+	header = codecs.AppendString(header, w.options.codecName)
+	header = codecs.AppendString(header, w.options.blockFormat.Name())
+	if err := w.write(header); err != nil {
+		w.Abort()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Writer[K]) write(data []byte) error {
+	n, err := w.writer.Write(data)
+	w.offset += int64(n)
+	return err
+}
+
+// Add appends an entry, keys must be added in ascending order
+func (w *Writer[K]) Add(key K, value []byte) error {
+	if w.count > 0 && key <= w.last {
+		return fmt.Errorf("%w: %v after %v", ErrUnordered, key, w.last)
+	}
+	if len(w.block) == 0 {
+		w.first = key
+	}
+	if w.options.bloomRate > 0 {
+		w.hashes = append(w.hashes, bloom.Hash(codecs.AppendOrdered(nil, key)))
+	}
+	w.block = codecs.AppendOrdered(w.block, key)
+	w.block = codecs.AppendBytes(w.block, value)
+	w.last = key
+	w.count++
+	if len(w.block) >= w.options.blockSize {
+		return w.flushBlock()
+	}
+	return nil
+}
+
+// Count returns the number of entries added
+func (w *Writer[K]) Count() int {
+	return w.count
+}
+
+// Size returns the number of bytes written so far, including the pending entries of the current data block
+func (w *Writer[K]) Size() int64 {
+	return w.offset + int64(len(w.block))
+}
+
+// SetMetadata replaces the metadata given by WithMetadata, it is written by Close
+func (w *Writer[K]) SetMetadata(metadata []byte) {
+	w.metadata = metadata
+}
+
+func (w *Writer[K]) flushBlock() error {
+	offset, size, err := w.writeBlock(w.block)
+	if err != nil {
+		return err
+	}
+	w.index = codecs.AppendOrdered(w.index, w.first)
+	w.index = codecs.AppendOrdered(w.index, w.last)
+	w.index = binary.AppendUvarint(w.index, uint64(offset))
+	w.index = binary.AppendUvarint(w.index, uint64(size))
+	w.block = w.block[:0]
+	return nil
+}
+
+// writeBlock writes a block in the block format followed by its checksum
+func (w *Writer[K]) writeBlock(block []byte) (offset int64, size int64, err error) {
+	data, err := w.options.blockFormat.Marshal(block)
+	if err != nil {
+		return 0, 0, err
+	}
+	data = binary.LittleEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+	offset = w.offset
+	return offset, int64(len(data)), w.write(data)
+}
+
+// Close completes the table: it writes the last data block, the metadata, the filter, the index and the footer,
+// syncs the file and renames it to the filename of the table. The writer is aborted if completing the table fails.
+func (w *Writer[K]) Close() (err error) {
+	defer func() {
+		if err != nil {
+			w.Abort()
+		}
+	}()
+	if len(w.block) > 0 {
+		if err = w.flushBlock(); err != nil {
+			return err
+		}
+	}
+	metaOffset, metaSize, err := w.writeBlock(w.metadata)
+	if err != nil {
+		return err
+	}
+	var filterOffset, filterSize int64
+	if w.options.bloomRate > 0 {
+		filter := bloom.New(len(w.hashes), w.options.bloomRate)
+		for _, hash := range w.hashes {
+			filter.AddHash(hash)
+		}
+		data, _ := filter.MarshalBinary()
+		if filterOffset, filterSize, err = w.writeBlock(data); err != nil {
+			return err
+		}
+	}
+	offset, size, err := w.writeBlock(w.index)
+	if err != nil {
+		return err
+	}
+	footer := binary.LittleEndian.AppendUint64(nil, uint64(metaOffset))
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(metaSize))
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(filterOffset))
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(filterSize))
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(offset))
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(size))
+	footer = binary.LittleEndian.AppendUint64(footer, uint64(w.count))
+	footer = append(footer, magic...)
+	if err = w.write(footer); err != nil {
+		return err
+	} else if err = w.writer.Flush(); err != nil {
+		return err
+	} else if err = w.file.Sync(); err != nil {
+		return err
+	} else if err = w.file.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(w.file.Name(), w.filename); err != nil {
+		return err
+	}
+	return fsutil.SyncDir(w.filename)
+}
+
+// Abort discards the table
+func (w *Writer[K]) Abort() {
+	w.file.Close()
+	os.Remove(w.file.Name())
+}